@@ -2,8 +2,43 @@
 # Usage: ./deploy.sh
 # Description: Deploy the function to GCP
 # Prerequisites: gcloud CLI installed and configured
+# Gifts for several siblings are split evenly unless SPLIT_POLICY is set
+# to full, first, explicit or weighted:<weights>, e.g.
+#   gcloud functions deploy $FUNCTION_NAME --update-env-vars SPLIT_POLICY=full
+# Uploads named like 2024-12-12-Report.xlsx, .csv or .tsv are reported on
+# with the roster parents-kids-classes.xlsx as
+# donations_by_student-<date>.xlsx.  Any input may be a CSV or TSV file
+# instead of a workbook, e.g. ROSTER_FILE=roster.csv; its encoding and
+# delimiter are detected.
+# Families and students listed in participation-exclusions.xlsx, such as
+# scholarship families, are left out of the participation rates, and the
+# school, grade and class goals in goals.xlsx are shown with what has been
+# raised towards them; goals naming a campaign only apply to the profile
+# of that name or to the gifts of that campaign.  Gifts are tagged with
+# their campaign from the Campaign or Fund column of the export, or by the
+# date ranges and memo keywords in campaigns.xlsx.
+# INPUT_PATTERN, DATE_PATTERN, DATE_LAYOUT, ROSTER_FILE, ALIASES_FILE,
+# EXCLUSIONS_FILE, GOALS_FILE, CAMPAIGNS_FILE, OUTPUT_PREFIX and
+# OUTPUT_FOLDER change that, or a datacor.json in the bucket lists a
+# profile of those settings for every school or campaign:
+#   {"profiles": [{"name": "auction", "inputs": ["^auction/.*\\.xlsx$"],
+#     "roster": "auction/roster.xlsx", "output_folder": "auction/reports"}]}
 set -xe
 
 FUNCTION_NAME="donations-by-student-report"
 
-gcloud functions deploy $FUNCTION_NAME --source .
+# Retryable failures, such as a storage outage, are retried; uploads that
+# can't be processed get a <upload>.error.json file explaining why.
+# Processed uploads are archived under archive/<run ID>/ along with the
+# roster they were reported against; set ARCHIVE_RETENTION_DAYS to remove
+# archived runs after that many days.  A run whose report was written but
+# whose inputs could not be archived only logs a warning and keeps the
+# upload.
+# Each processed upload version is recorded under runs/ so a repeated event
+# is skipped, and locks/ keeps two uploads for the same date from writing
+# the same report at once.
+# Every upload's donations are kept in history/donations.csv; set
+# HISTORY_FROM=YYYY-MM-DD, e.g. the start of the school year, to report on
+# the history from that date through the upload's date instead of the
+# upload alone.
+gcloud functions deploy $FUNCTION_NAME --source . --retry
@@ -0,0 +1,423 @@
+// Package alloc distributes donation transactions to the students they
+// were made for.
+package alloc
+
+import (
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/match"
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Adjustment describes how a refund or chargeback was applied.
+type Adjustment struct {
+	Refund *types.DonationTransaction
+	// Original is the gift the refund was matched to, nil when no
+	// matching gift was found in the transactions.
+	Original *types.DonationTransaction
+	// Students lists the students whose amounts were reduced.
+	Students []string
+	Note     string
+}
+
+// StudentMatch records a student named on a gift that wasn't matched
+// exactly to a roster student, for a volunteer to review.
+type StudentMatch struct {
+	Txn   *types.DonationTransaction
+	Ref   types.StudentRef
+	Match match.Match
+	// Share is the part of the gift meant for the student, which is
+	// left out of the report when the student wasn't matched
+	Share money.Cents
+}
+
+// Result holds what a volunteer needs to review after the donations have
+// been assigned.
+type Result struct {
+	Adjustments []Adjustment
+	Matches     []StudentMatch
+	// Kinds classifies every transaction by who gave it
+	Kinds map[*types.DonationTransaction]types.DonorKind
+}
+
+// Assign distributes the donation amounts to the respective students
+// based on the donation transactions.  A gift that doesn't name any
+// student but comes from a family account on the roster is given that
+// family's children.  Gifts are assigned first; refunds and chargebacks
+// are then matched to the gift they reverse and reduce the amounts of
+// the students that gift was assigned to.  Gifts for several
+// students are split evenly; see AssignWith for other policies.
+func Assign(students types.AllStudents, donations []*types.DonationTransaction) Result {
+	return AssignWith(students, donations, EvenSplit{})
+}
+
+// AssignWith distributes the donations like Assign, sharing gifts for
+// several students according to policy.
+func AssignWith(students types.AllStudents, donations []*types.DonationTransaction, policy Policy) Result {
+	idx := match.NewIndex(students)
+
+	result := Result{Kinds: make(map[*types.DonationTransaction]types.DonorKind)}
+
+	// Refunds are matched to their gift first and only fall back to the
+	// family when it isn't found
+	for _, txn := range donations {
+		if txn.Amount > 0 && len(txn.StudentNames()) == 0 {
+			txn.Students = append(txn.Students, idx.Family(txn.AccountNumber)...)
+		}
+	}
+
+	var refunds []*types.DonationTransaction
+
+	for _, txn := range donations {
+		if txn.Amount < 0 {
+			refunds = append(refunds, txn)
+			continue
+		}
+
+		refs, matches := resolve(idx, txn)
+		siblings := keys(matches)
+
+		result.Kinds[txn] = classify(students, siblings, txn)
+
+		// Skip if there are no valid siblings.  We'll have to deal with this separately
+		if len(siblings) == 0 {
+			continue
+		}
+
+		// Share the amount across the siblings, to the penny
+		shares := policy.Shares(txn.Amount, refs)
+
+		// Update each student's donation information
+		for i, sibling := range siblings {
+			if matches[i].Method != match.Exact && matches[i].Method != match.ByID {
+				result.Matches = append(result.Matches, StudentMatch{
+					Txn:   txn,
+					Ref:   refs[i],
+					Match: matches[i],
+					Share: shares[i],
+				})
+			}
+
+			// An unmatched student is listed among the matches above
+			student, exists := students[sibling]
+			if !exists {
+				continue
+			}
+
+			// The policy may leave a sibling out of the gift
+			if shares[i] == 0 {
+				continue
+			}
+
+			addDonation(&student, txn, shares[i])
+
+			// Save the updated student back to the map
+			students[sibling] = student
+		}
+	}
+
+	result.Adjustments = applyRefunds(students, idx, policy, donations, refunds, result.Kinds)
+
+	return result
+}
+
+// resolve matches the students named on the transaction to the roster.
+// It returns the named students and their matches in the same order.
+func resolve(idx *match.Index, txn *types.DonationTransaction) ([]types.StudentRef, []match.Match) {
+	var refs []types.StudentRef
+	var matches []match.Match
+	for _, ref := range txn.Students {
+		if ref.Name == "" {
+			continue
+		}
+		refs = append(refs, ref)
+		matches = append(matches, idx.Match(ref))
+	}
+	return refs, matches
+}
+
+// keys returns the student keys of the matches.  A student that wasn't
+// matched gets an empty key so that a gift is still split across every
+// named student.
+func keys(matches []match.Match) []string {
+	keys := []string{}
+	for _, m := range matches {
+		keys = append(keys, m.Key)
+	}
+	return keys
+}
+
+// resolveKeys returns the keys of the roster students named on the
+// transaction.
+func resolveKeys(idx *match.Index, txn *types.DonationTransaction) []string {
+	_, matches := resolve(idx, txn)
+	return keys(matches)
+}
+
+// applyRefunds matches every refund to the gift it reverses and takes
+// the refunded amount back from the students of that gift.
+func applyRefunds(students types.AllStudents, idx *match.Index, policy Policy, donations, refunds []*types.DonationTransaction, kinds map[*types.DonationTransaction]types.DonorKind) []Adjustment {
+	// refundable tracks what is left of each gift after earlier refunds
+	refundable := make(map[*types.DonationTransaction]money.Cents)
+	for _, txn := range donations {
+		if txn.Amount > 0 {
+			refundable[txn] = txn.Amount
+		}
+	}
+
+	var adjustments []Adjustment
+
+	for _, refund := range refunds {
+		adj := Adjustment{Refund: refund}
+
+		original := matchRefund(idx, refund, donations, refundable)
+
+		var refs []types.StudentRef
+		var matches []match.Match
+		donor := refund
+
+		switch {
+		case original != nil:
+			refundable[original] += refund.Amount
+			adj.Original = original
+			donor = original
+			refs, matches = resolve(idx, original)
+			if len(matches) == 0 {
+				adj.Note = "Refund of a gift not made for a student"
+			}
+		case len(refund.StudentNames()) > 0:
+			refs, matches = resolve(idx, refund)
+			adj.Note = "Original gift not found, refund applied to the students named on the refund"
+		case len(idx.Family(refund.AccountNumber)) > 0:
+			refund.Students = append(refund.Students, idx.Family(refund.AccountNumber)...)
+			refs, matches = resolve(idx, refund)
+			adj.Note = "Original gift not found, refund applied to the students of the family account"
+		default:
+			adj.Note = "Original gift not found, refund not applied to any student"
+		}
+
+		siblings := keys(matches)
+		kinds[refund] = classify(students, siblings, donor)
+
+		if len(siblings) > 0 {
+			shares := policy.Shares(refund.Amount, refs)
+			for i, sibling := range siblings {
+				student, exists := students[sibling]
+				if !exists || shares[i] == 0 {
+					continue
+				}
+
+				removeDonation(&student, donor, shares[i])
+				students[sibling] = student
+				adj.Students = append(adj.Students, student.Name)
+			}
+		}
+
+		if adj.Note == "" {
+			adj.Note = "Refund matched to the original gift"
+		}
+
+		adjustments = append(adjustments, adj)
+	}
+
+	return adjustments
+}
+
+// matchRefund finds the gift a refund reverses.  Gifts must come from the
+// same donor; when the refund names students they must be the students
+// of the gift.  A gift with the exact refunded amount left is preferred
+// over a partially refunded one.
+func matchRefund(idx *match.Index, refund *types.DonationTransaction, donations []*types.DonationTransaction, refundable map[*types.DonationTransaction]money.Cents) *types.DonationTransaction {
+	var partial *types.DonationTransaction
+
+	for _, txn := range donations {
+		left, ok := refundable[txn]
+		if !ok || left < -refund.Amount {
+			continue
+		}
+
+		if !sameDonor(txn, refund) {
+			continue
+		}
+
+		if named := resolveKeys(idx, refund); len(named) > 0 && !sameStudents(named, resolveKeys(idx, txn)) {
+			continue
+		}
+
+		if left == -refund.Amount {
+			return txn
+		}
+		if partial == nil {
+			partial = txn
+		}
+	}
+
+	return partial
+}
+
+// sameDonor reports whether two transactions come from the same donor:
+// the same account when both have one, otherwise the same name.
+func sameDonor(a, b *types.DonationTransaction) bool {
+	if a.AccountNumber != "" && b.AccountNumber != "" {
+		return strings.EqualFold(strings.TrimSpace(a.AccountNumber), strings.TrimSpace(b.AccountNumber))
+	}
+	return strings.EqualFold(strings.TrimSpace(a.Name), strings.TrimSpace(b.Name))
+}
+
+// addDonation credits a share of a gift to the student and its donor.
+// Donors are added to the student's primary donors in order of their
+// first gift, under the name on that gift.
+func addDonation(student *types.Student, txn *types.DonationTransaction, amount money.Cents) {
+	// Update the total donation amount
+	student.TotalDonationAmount += amount
+	addGift(student, txn, amount)
+	addCampaign(student, txn, amount)
+
+	kind := donorKind(student, txn)
+	addSubtotal(student, kind, amount)
+
+	// Update the primary donors and their donation amounts
+	if donor := findDonor(student, txn); donor != nil {
+		donor.Amount += amount
+		if donor.Account == "" {
+			donor.Account = txn.AccountNumber
+		}
+		return
+	}
+
+	student.PrimaryDonors = append(student.PrimaryDonors, types.Donor{
+		Name:    txn.Name,
+		Amount:  amount,
+		Kind:    kind,
+		Account: txn.AccountNumber,
+	})
+}
+
+// removeDonation takes a refunded share back from the student and, if
+// they are one of the student's primary donors, from the donor.  A
+// refunding donor never becomes a primary donor.
+func removeDonation(student *types.Student, txn *types.DonationTransaction, amount money.Cents) {
+	student.TotalDonationAmount += amount
+	addGift(student, txn, amount)
+	addCampaign(student, txn, amount)
+
+	donor := findDonor(student, txn)
+	if donor == nil {
+		addSubtotal(student, donorKind(student, txn), amount)
+		return
+	}
+
+	donor.Amount += amount
+	addSubtotal(student, donor.Kind, amount)
+}
+
+// addGift adds amount to the student's share of the gift.  A refund
+// matched to its gift is taken from that gift's share.
+func addGift(student *types.Student, txn *types.DonationTransaction, amount money.Cents) {
+	if student.Gifts == nil {
+		student.Gifts = make(map[*types.DonationTransaction]money.Cents)
+	}
+	student.Gifts[txn] += amount
+}
+
+// addCampaign adds amount to the student's total for the campaign of the
+// gift.  A refund matched to its gift is taken from the gift's campaign.
+func addCampaign(student *types.Student, txn *types.DonationTransaction, amount money.Cents) {
+	if student.Campaigns == nil {
+		student.Campaigns = make(map[string]money.Cents)
+	}
+	student.Campaigns[txn.Campaign] += amount
+}
+
+// addSubtotal adds amount to the care giver or other subtotal of the
+// student.
+func addSubtotal(student *types.Student, kind types.DonorKind, amount money.Cents) {
+	if kind == types.CareGiverDonor {
+		student.CareGiverAmount += amount
+	} else {
+		student.OtherAmount += amount
+	}
+}
+
+// classify returns who gave the transaction: a care giver of any of the
+// students it was assigned to, someone else, or nobody we can tell when
+// it wasn't assigned to any student.
+func classify(students types.AllStudents, siblings []string, txn *types.DonationTransaction) types.DonorKind {
+	kind := types.Unattributed
+	for _, sibling := range siblings {
+		student, exists := students[sibling]
+		if !exists {
+			continue
+		}
+		if donorKind(&student, txn) == types.CareGiverDonor {
+			return types.CareGiverDonor
+		}
+		kind = types.OtherDonor
+	}
+	return kind
+}
+
+// donorKind tells whether the transaction comes from a care giver of the
+// student, either from one of the student's family accounts or under the
+// name of one of the student's parents on the roster.
+func donorKind(student *types.Student, txn *types.DonationTransaction) types.DonorKind {
+	if txn.AccountNumber != "" {
+		for _, account := range student.Accounts {
+			if strings.EqualFold(strings.TrimSpace(account), strings.TrimSpace(txn.AccountNumber)) {
+				return types.CareGiverDonor
+			}
+		}
+	}
+	for _, parent := range student.Parents {
+		if sameName(parent, txn.Name) {
+			return types.CareGiverDonor
+		}
+	}
+	return types.OtherDonor
+}
+
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+// findDonor returns the student's primary donor who made the
+// transaction.  Donors are the same when they have the same account,
+// whatever the name on the gift, or when either account is unknown and
+// they have the same name.
+func findDonor(student *types.Student, txn *types.DonationTransaction) *types.Donor {
+	for i := range student.PrimaryDonors {
+		donor := &student.PrimaryDonors[i]
+		if donor.Account != "" && txn.AccountNumber != "" {
+			if donor.Account == txn.AccountNumber {
+				return donor
+			}
+			continue
+		}
+		if donor.Name == txn.Name {
+			return donor
+		}
+	}
+	return nil
+}
+
+// sameStudents reports whether both lists hold the same student keys, in
+// any order.
+func sameStudents(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, key := range a {
+		seen[key]++
+	}
+	for _, key := range b {
+		seen[key]--
+	}
+	for _, n := range seen {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,353 @@
+package alloc
+
+import (
+	"testing"
+
+	"github.com/jotacamou/datacor/internal/match"
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+func newStudents(names ...string) types.AllStudents {
+	students := make(types.AllStudents)
+	for _, name := range names {
+		student := types.Student{Name: name}
+		students[student.Key()] = student
+	}
+	return students
+}
+
+func key(name string) string {
+	return types.StudentKey("", name, "")
+}
+
+func refs(names ...string) []types.StudentRef {
+	var students []types.StudentRef
+	for _, name := range names {
+		students = append(students, types.StudentRef{Name: name})
+	}
+	return students
+}
+
+func TestAssignManyDonors(t *testing.T) {
+	students := newStudents("Sam")
+	var donations []*types.DonationTransaction
+	for _, donor := range []string{"Mom", "Dad", "Grandma", "Uncle", "Mom"} {
+		donations = append(donations, &types.DonationTransaction{Name: donor, Amount: 1000, Students: refs("Sam")})
+	}
+
+	Assign(students, donations)
+
+	sam := students[key("Sam")]
+	if len(sam.PrimaryDonors) != 4 {
+		t.Fatalf("got %d donors, want 4: %+v", len(sam.PrimaryDonors), sam.PrimaryDonors)
+	}
+	if sam.PrimaryDonors[0].Amount != 2000 || sam.PrimaryDonors[3].Name != "Uncle" || sam.TotalDonationAmount != 5000 || len(sam.Gifts) != 5 {
+		t.Errorf("unexpected donors: %+v", sam)
+	}
+}
+
+func TestAssignSplitsToThePenny(t *testing.T) {
+	students := newStudents("Sam", "Ana", "Max")
+	donations := []*types.DonationTransaction{
+		{Name: "Jane", Amount: 10000, Students: refs("Sam", "Ana", "Max")},
+	}
+
+	Assign(students, donations)
+
+	var total money.Cents
+	for _, student := range students {
+		total += student.TotalDonationAmount
+		if len(student.PrimaryDonors) != 1 || student.PrimaryDonors[0].Name != "Jane" {
+			t.Errorf("unexpected donors for %s: %+v", student.Name, student)
+		}
+	}
+	if total != 10000 {
+		t.Errorf("got total %d, want 10000", total)
+	}
+}
+
+func TestAssignCampaigns(t *testing.T) {
+	students := newStudents("Sam")
+	donations := []*types.DonationTransaction{
+		{Name: "Jane Doe", Amount: 5000, Students: refs("Sam"), Campaign: "Auction"},
+		{Name: "Jane Doe", Amount: 1000, Students: refs("Sam")},
+		// The refund is taken from the campaign of its gift
+		{Name: "Jane Doe", Amount: -5000},
+	}
+
+	Assign(students, donations)
+
+	sam := students[key("Sam")]
+	if sam.Campaigns["Auction"] != 0 || sam.Campaigns[""] != 1000 || sam.TotalDonationAmount != 1000 {
+		t.Errorf("unexpected campaigns: %+v", sam.Campaigns)
+	}
+}
+
+func TestAssignRefunds(t *testing.T) {
+	students := newStudents("Sam", "Ana")
+	donations := []*types.DonationTransaction{
+		// The refund is listed before the gift it reverses
+		{Name: "jane doe", Amount: -5000, AccountNumber: "A1"},
+		{Name: "Jane Doe", Amount: 5000, AccountNumber: "A1", Students: refs("Sam", "Ana")},
+		{Name: "Jane Doe", Amount: 2000, AccountNumber: "A1", Students: refs("Sam")},
+		{Name: "Bob", Amount: -1000, Students: refs("Sam")},
+		{Name: "Eve", Amount: -700},
+	}
+
+	adjustments := Assign(students, donations).Adjustments
+
+	if len(adjustments) != 3 {
+		t.Fatalf("got %d adjustments, want 3", len(adjustments))
+	}
+
+	if adjustments[0].Original != donations[1] {
+		t.Errorf("refund matched to %+v, want the $50.00 gift", adjustments[0].Original)
+	}
+	if adjustments[1].Original != nil || len(adjustments[1].Students) != 1 {
+		t.Errorf("unexpected adjustment: %+v", adjustments[1])
+	}
+	if adjustments[2].Original != nil || len(adjustments[2].Students) != 0 {
+		t.Errorf("unexpected adjustment: %+v", adjustments[2])
+	}
+
+	sam := students[key("Sam")]
+	if len(sam.PrimaryDonors) != 1 {
+		t.Fatalf("refunding donor became a primary donor: %+v", sam)
+	}
+	if sam.TotalDonationAmount != 1000 || sam.PrimaryDonors[0].Amount != 2000 {
+		t.Errorf("unexpected amounts for Sam: %+v", sam)
+	}
+
+	ana := students[key("Ana")]
+	if ana.TotalDonationAmount != 0 || ana.PrimaryDonors[0].Amount != 0 {
+		t.Errorf("unexpected amounts for Ana: %+v", ana)
+	}
+
+	// A refund from a family account matches the gift it reverses, not
+	// every child of the family
+	students = make(types.AllStudents)
+	for _, student := range []types.Student{
+		{Name: "Sam Doe", Accounts: []string{"A1"}},
+		{Name: "Ana Doe", Accounts: []string{"A1"}},
+	} {
+		students[student.Key()] = student
+	}
+
+	donations = []*types.DonationTransaction{
+		{Name: "Jane Doe", Amount: 5000, AccountNumber: "A1", Students: refs("Sam Doe")},
+		{Name: "Jane Doe", Amount: -5000, AccountNumber: "A1"},
+		// No gift to match, the family's children give it back
+		{Name: "Jane Doe", Amount: -1000, AccountNumber: "A1"},
+	}
+
+	adjustments = Assign(students, donations).Adjustments
+
+	if len(adjustments) != 2 {
+		t.Fatalf("got %d adjustments, want 2", len(adjustments))
+	}
+	if adjustments[0].Original != donations[0] || adjustments[0].Note != "Refund matched to the original gift" {
+		t.Errorf("refund not matched to the gift for Sam: %+v", adjustments[0])
+	}
+	if adjustments[1].Original != nil || len(adjustments[1].Students) != 2 {
+		t.Errorf("unmatched refund not applied to the family: %+v", adjustments[1])
+	}
+
+	if got := students[key("Sam Doe")].TotalDonationAmount; got != -500 {
+		t.Errorf("Sam Doe: got %d, want -500", got)
+	}
+	if got := students[key("Ana Doe")].TotalDonationAmount; got != -500 {
+		t.Errorf("Ana Doe: got %d, want -500", got)
+	}
+}
+
+func TestAssignSameNameDifferentClass(t *testing.T) {
+	students := make(types.AllStudents)
+	for _, student := range []types.Student{
+		{Name: "Sam Lee", Class: "K"},
+		{Name: "Sam Lee", Class: "3"},
+		{ID: "S42", Name: "Ana Roe", Class: "1"},
+	} {
+		students[student.Key()] = student
+	}
+
+	donations := []*types.DonationTransaction{
+		{Name: "Jane", Amount: 1000, Students: []types.StudentRef{{Name: "sam lee", Class: "3"}}},
+		{Name: "John", Amount: 500, Students: []types.StudentRef{{Name: "Sam Lee"}}},
+		{Name: "Mia", Amount: 700, Students: []types.StudentRef{{ID: "s42", Name: "Anna Roe"}}},
+	}
+
+	Assign(students, donations)
+
+	if got := students[types.StudentKey("", "Sam Lee", "3")].TotalDonationAmount; got != 1000 {
+		t.Errorf("Sam Lee in 3: got %d, want 1000", got)
+	}
+	if got := students[types.StudentKey("", "Sam Lee", "K")].TotalDonationAmount; got != 0 {
+		t.Errorf("Sam Lee in K: got %d, want 0", got)
+	}
+	if got := students[types.StudentKey("S42", "", "")].TotalDonationAmount; got != 700 {
+		t.Errorf("Ana Roe: got %d, want 700", got)
+	}
+}
+
+func TestAssignRecordsInexactMatches(t *testing.T) {
+	students := newStudents("Jonathan Smith", "Ana Roe")
+	donations := []*types.DonationTransaction{
+		{Name: "Jane", Amount: 1000, Students: refs("Jonny Smith", "Ana Roe")},
+		{Name: "John", Amount: 500, Students: refs("Somebody Else")},
+	}
+
+	result := Assign(students, donations)
+
+	if got := students[key("Jonathan Smith")].TotalDonationAmount; got != 500 {
+		t.Errorf("Jonathan Smith: got %d, want 500", got)
+	}
+	if len(result.Matches) != 2 {
+		t.Fatalf("got %d matches, want 2: %+v", len(result.Matches), result.Matches)
+	}
+	if m := result.Matches[0]; m.Match.Method != match.Nickname || m.Share != 500 {
+		t.Errorf("unexpected match: %+v", m)
+	}
+	if m := result.Matches[1]; m.Match.Method != match.Unmatched || m.Share != 500 || m.Txn != donations[1] {
+		t.Errorf("unexpected match: %+v", m)
+	}
+}
+
+func TestAssignByAccount(t *testing.T) {
+	students := make(types.AllStudents)
+	for _, student := range []types.Student{
+		{Name: "Sam Doe", Class: "K", Accounts: []string{"A1"}},
+		{Name: "Ana Doe", Class: "2", Accounts: []string{"A1"}},
+		{Name: "Max Roe", Class: "1", Accounts: []string{"A2"}},
+	} {
+		students[student.Key()] = student
+	}
+
+	donations := []*types.DonationTransaction{
+		{Name: "Jane Doe", Amount: 1000, AccountNumber: "A1"},
+		{Name: "Jane M. Doe", Amount: 500, AccountNumber: "A1", Students: []types.StudentRef{{Name: "Sam Doe", Class: "K"}}},
+		{Name: "Jane Doe", Amount: 300, AccountNumber: "A9", Students: []types.StudentRef{{Name: "Sam Doe", Class: "K"}}},
+		{Name: "Bob Roe", Amount: 700, AccountNumber: "A3"},
+	}
+
+	Assign(students, donations)
+
+	sam := students[types.StudentKey("", "Sam Doe", "K")]
+	if sam.TotalDonationAmount != 1300 || len(sam.PrimaryDonors) != 2 {
+		t.Fatalf("unexpected donors for Sam: %+v", sam)
+	}
+	if d := sam.PrimaryDonors[0]; d.Name != "Jane Doe" || d.Amount != 1000 || d.Account != "A1" {
+		t.Errorf("gifts from the same account not counted as one donor: %+v", d)
+	}
+	if got := students[types.StudentKey("", "Ana Doe", "2")].TotalDonationAmount; got != 500 {
+		t.Errorf("Ana Doe: got %d, want 500", got)
+	}
+	if got := students[types.StudentKey("", "Max Roe", "1")].TotalDonationAmount; got != 0 {
+		t.Errorf("Max Roe: got %d, want 0", got)
+	}
+	if len(donations[3].Students) != 0 {
+		t.Errorf("unknown account given students: %+v", donations[3])
+	}
+}
+
+func TestAssignClassifiesDonors(t *testing.T) {
+	students := make(types.AllStudents)
+	sam := types.Student{Name: "Sam Doe", Class: "K", Parents: []string{"Jane Doe"}, Accounts: []string{"A1"}}
+	students[sam.Key()] = sam
+
+	donations := []*types.DonationTransaction{
+		{Name: "jane  doe", Amount: 1000, Students: refs("Sam Doe")},
+		{Name: "J. Doe", Amount: 500, AccountNumber: "A1", Students: refs("Sam Doe")},
+		{Name: "Grandma", Amount: 700, Students: refs("Sam Doe")},
+		{Name: "Grandma", Amount: -200, Students: refs("Sam Doe")},
+		{Name: "Neighbor", Amount: 300},
+	}
+
+	result := Assign(students, donations)
+
+	sam = students[sam.Key()]
+	if sam.CareGiverAmount != 1500 || sam.OtherAmount != 500 || sam.TotalDonationAmount != 2000 {
+		t.Errorf("unexpected subtotals: %+v", sam)
+	}
+	if sam.PrimaryDonors[0].Kind != types.CareGiverDonor || sam.PrimaryDonors[2].Kind != types.OtherDonor {
+		t.Errorf("unexpected donor kinds: %+v", sam.PrimaryDonors)
+	}
+
+	want := []types.DonorKind{types.CareGiverDonor, types.CareGiverDonor, types.OtherDonor, types.OtherDonor, types.Unattributed}
+	for i, txn := range donations {
+		if result.Kinds[txn] != want[i] {
+			t.Errorf("transaction %d: got %q, want %q", i, result.Kinds[txn], want[i])
+		}
+	}
+}
+
+func TestAssignWithPolicies(t *testing.T) {
+	gift := func() []*types.DonationTransaction {
+		return []*types.DonationTransaction{
+			{Name: "Jane", Amount: 9000, Students: []types.StudentRef{{Name: "Sam", Amount: 6000}, {Name: "Ana", Amount: 3000}}},
+			{Name: "Jane", Amount: -9000, Students: []types.StudentRef{{Name: "Sam"}, {Name: "Ana"}}},
+			{Name: "John", Amount: 1000, Students: refs("Sam", "Ana")},
+		}
+	}
+
+	tests := []struct {
+		policy   string
+		sam, ana money.Cents
+	}{
+		{"", 500, 500},
+		{"full", 1000, 1000},
+		{"first", 1000, 0},
+		{"weighted:3,1", 750, 250},
+		{"explicit", 500, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			policy, err := ParsePolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			students := newStudents("Sam", "Ana")
+			AssignWith(students, gift(), policy)
+
+			sam, ana := students[key("Sam")], students[key("Ana")]
+			if sam.TotalDonationAmount != tt.sam || ana.TotalDonationAmount != tt.ana {
+				t.Errorf("%s: got Sam %d and Ana %d, want %d and %d", policy.Name(), sam.TotalDonationAmount, ana.TotalDonationAmount, tt.sam, tt.ana)
+			}
+			if tt.ana == 0 && len(ana.PrimaryDonors) != 0 {
+				t.Errorf("%s: donor listed for a student left out of the gift: %+v", policy.Name(), ana)
+			}
+		})
+	}
+
+	students := newStudents("Sam", "Ana")
+	donations := gift()
+	AssignWith(students, donations[:1], ExplicitAmounts{Fallback: EvenSplit{}})
+	if got := students[key("Sam")].TotalDonationAmount; got != 6000 {
+		t.Errorf("explicit amounts: got Sam %d, want 6000", got)
+	}
+
+	students = newStudents("Sam", "Ana")
+	AssignWith(students, donations[2:], Weighted{Weights: []int{0, 1}})
+	if got := students[key("Sam")].TotalDonationAmount; got != 0 {
+		t.Errorf("zero weight: got Sam %d, want 0", got)
+	}
+	students = newStudents("Sam")
+	AssignWith(students, []*types.DonationTransaction{{Name: "John", Amount: 1000, Students: refs("Sam")}}, Weighted{Weights: []int{0, 1}})
+	if got := students[key("Sam")].TotalDonationAmount; got != 1000 {
+		t.Errorf("only zero weights named: got Sam %d, want 1000", got)
+	}
+
+	if _, err := ParsePolicy("weighted:a,1"); err == nil {
+		t.Errorf("expected an error for an invalid weight")
+	}
+	for _, s := range []string{"weighted:0", "weighted:0,0"} {
+		if _, err := ParsePolicy(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+	if _, err := ParsePolicy("random"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
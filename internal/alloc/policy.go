@@ -0,0 +1,157 @@
+package alloc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Policy decides how a gift that names several students is credited to
+// each of them.
+type Policy interface {
+	// Name describes the policy in the report
+	Name() string
+	// Shares returns the amount credited to each named student, in the
+	// order they were named.  Refunds are shared the same way as gifts.
+	Shares(amount money.Cents, students []types.StudentRef) []money.Cents
+}
+
+// EvenSplit divides the gift evenly, to the penny, across the students.
+type EvenSplit struct{}
+
+func (EvenSplit) Name() string { return "Even split" }
+
+func (EvenSplit) Shares(amount money.Cents, students []types.StudentRef) []money.Cents {
+	return amount.Split(len(students))
+}
+
+// FullCredit credits the whole gift to every student, as used to count
+// participation.  Student totals then add up to more than was given.
+type FullCredit struct{}
+
+func (FullCredit) Name() string { return "Full credit to each student" }
+
+func (FullCredit) Shares(amount money.Cents, students []types.StudentRef) []money.Cents {
+	shares := make([]money.Cents, len(students))
+	for i := range shares {
+		shares[i] = amount
+	}
+	return shares
+}
+
+// FirstNamed credits the whole gift to the first student named.
+type FirstNamed struct{}
+
+func (FirstNamed) Name() string { return "First named student only" }
+
+func (FirstNamed) Shares(amount money.Cents, students []types.StudentRef) []money.Cents {
+	weights := make([]int, len(students))
+	if len(weights) > 0 {
+		weights[0] = 1
+	}
+	return amount.Allocate(weights)
+}
+
+// Weighted divides the gift by the position the students were named in,
+// e.g. weights 2, 1 give the first student two thirds.  Students named
+// after the last weight get the last weight, so weights 2, 1, 0 leave
+// out every student named after the second.  A gift whose named students
+// all have a zero weight is split evenly rather than dropped.
+type Weighted struct {
+	Weights []int
+}
+
+func (p Weighted) Name() string {
+	weights := make([]string, len(p.Weights))
+	for i, w := range p.Weights {
+		weights[i] = strconv.Itoa(w)
+	}
+	return "Weighted split " + strings.Join(weights, ":")
+}
+
+func (p Weighted) Shares(amount money.Cents, students []types.StudentRef) []money.Cents {
+	if len(p.Weights) == 0 {
+		return EvenSplit{}.Shares(amount, students)
+	}
+	weights := make([]int, len(students))
+	total := 0
+	for i := range weights {
+		weights[i] = p.Weights[min(i, len(p.Weights)-1)]
+		total += weights[i]
+	}
+	if total == 0 {
+		return EvenSplit{}.Shares(amount, students)
+	}
+	return amount.Allocate(weights)
+}
+
+// ExplicitAmounts credits each student the amount the donation platform
+// recorded for them.  When the recorded amounts don't add up to the gift
+// the Fallback policy is used instead.
+type ExplicitAmounts struct {
+	Fallback Policy
+}
+
+func (p ExplicitAmounts) Name() string {
+	return "Amounts per student, otherwise " + strings.ToLower(p.Fallback.Name())
+}
+
+func (p ExplicitAmounts) Shares(amount money.Cents, students []types.StudentRef) []money.Cents {
+	shares := make([]money.Cents, len(students))
+	var total money.Cents
+	for i, student := range students {
+		shares[i] = student.Amount
+		total += student.Amount
+	}
+
+	switch {
+	case total == 0:
+	case total == amount:
+		return shares
+	case total == -amount:
+		// A full refund of a gift recorded per student
+		for i := range shares {
+			shares[i] = -shares[i]
+		}
+		return shares
+	}
+
+	return p.Fallback.Shares(amount, students)
+}
+
+// ParsePolicy returns the policy named by s: "even" (the default when s
+// is empty), "full", "first", "explicit" or "weighted:2,1".
+func ParsePolicy(s string) (Policy, error) {
+	name, args, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+
+	switch name {
+	case "", "even":
+		return EvenSplit{}, nil
+	case "full":
+		return FullCredit{}, nil
+	case "first":
+		return FirstNamed{}, nil
+	case "explicit":
+		return ExplicitAmounts{Fallback: EvenSplit{}}, nil
+	case "weighted":
+		var weights []int
+		total := 0
+		for _, arg := range strings.Split(args, ",") {
+			w, err := strconv.Atoi(strings.TrimSpace(arg))
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid weight %q in split policy %q", arg, s)
+			}
+			weights = append(weights, w)
+			total += w
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("split policy %q needs at least one weight above zero", s)
+		}
+		return Weighted{Weights: weights}, nil
+	}
+
+	return nil, fmt.Errorf("unknown split policy %q, expected even, full, first, explicit or weighted:<weights>", s)
+}
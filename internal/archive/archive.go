@@ -0,0 +1,174 @@
+// Package archive keeps the exact inputs of every report run so that any
+// past report can be regenerated.  Each run gets its own folder under
+// Prefix holding a copy of the transactions upload, the roster and the
+// name corrections as they were, and a manifest with their checksums.
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/blob"
+)
+
+// Prefix is the folder of the store the runs are archived under.
+const Prefix = "archive/"
+
+// ManifestFile is the name of the manifest in a run's folder.
+const ManifestFile = "manifest.json"
+
+// runIDTime is the layout of the time a run ID starts with.
+const runIDTime = "20060102T150405Z"
+
+// Manifest describes an archived run.
+type Manifest struct {
+	RunID   string    `json:"run_id"`
+	Created time.Time `json:"created"`
+	// Output is the report generated from the files
+	Output string `json:"output"`
+	Policy string `json:"policy,omitempty"`
+	Files  []File `json:"files"`
+}
+
+// File is an input archived with a run.
+type File struct {
+	Name     string `json:"name"`
+	Archived string `json:"archived"`
+	SHA256   string `json:"sha256"`
+	Size     int    `json:"size"`
+}
+
+// Checksum returns the hex encoded SHA-256 of data.
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// RunID names a run after when it ran and the checksum of its upload,
+// e.g. 20241212T153000Z-3a7bd3e2360a.
+func RunID(now time.Time, upload []byte) string {
+	return now.UTC().Format(runIDTime) + "-" + Checksum(upload)[:12]
+}
+
+// Save copies the named files into the run's folder and writes its
+// manifest last, so a run with a manifest has all of its files.  Files
+// that don't exist, such as optional inputs, are left out.  The copies
+// are read back and checked against their checksums.
+func Save(ctx context.Context, store blob.Store, m Manifest, names ...string) (*Manifest, error) {
+	folder := Prefix + m.RunID + "/"
+
+	for _, name := range names {
+		data, err := store.Read(ctx, name)
+		if errors.Is(err, blob.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		file := File{
+			Name:     name,
+			Archived: folder + path.Base(name),
+			SHA256:   Checksum(data),
+			Size:     len(data),
+		}
+
+		if err := store.Write(ctx, file.Archived, data); err != nil {
+			return nil, err
+		}
+
+		copied, err := store.Read(ctx, file.Archived)
+		if err != nil {
+			return nil, err
+		}
+		if Checksum(copied) != file.SHA256 {
+			return nil, fmt.Errorf("archived copy of %s doesn't match the original", name)
+		}
+
+		m.Files = append(m.Files, file)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Write(ctx, folder+ManifestFile, data); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Latest returns the manifest of the most recent archived run that keep
+// accepts, or nil when there's none.
+func Latest(ctx context.Context, store blob.Store, keep func(*Manifest) bool) (*Manifest, error) {
+	names, err := store.List(ctx, Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run IDs start with the time of the run, so the list is oldest first
+	for i := len(names) - 1; i >= 0; i-- {
+		if path.Base(names[i]) != ManifestFile {
+			continue
+		}
+
+		data, err := store.Read(ctx, names[i])
+		if err != nil {
+			return nil, err
+		}
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("%s: %w", names[i], err)
+		}
+		if len(m.Files) > 0 && keep(&m) {
+			return &m, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Upload returns the transactions upload of the run, which is archived
+// first.
+func (m *Manifest) Upload() File {
+	return m.Files[0]
+}
+
+// Prune deletes the archived runs older than retention and returns the
+// IDs of the runs deleted.  A retention of zero keeps every run.
+func Prune(ctx context.Context, store blob.Store, now time.Time, retention time.Duration) ([]string, error) {
+	if retention <= 0 {
+		return nil, nil
+	}
+
+	names, err := store.List(ctx, Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, name := range names {
+		runID, _, _ := strings.Cut(strings.TrimPrefix(name, Prefix), "/")
+		ran, err := time.Parse(runIDTime, strings.SplitN(runID, "-", 2)[0])
+		if err != nil || now.Sub(ran) < retention {
+			continue
+		}
+
+		if err := store.Delete(ctx, name); err != nil && !errors.Is(err, blob.ErrNotExist) {
+			return pruned, err
+		}
+		if len(pruned) == 0 || pruned[len(pruned)-1] != runID {
+			pruned = append(pruned, runID)
+		}
+	}
+
+	return pruned, nil
+}
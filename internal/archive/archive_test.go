@@ -0,0 +1,60 @@
+package archive
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/blob"
+)
+
+func TestSaveAndPrune(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+	now := time.Date(2024, 12, 12, 15, 30, 0, 0, time.UTC)
+
+	upload := []byte("transactions")
+	store.Write(ctx, "2024-12-12-Report.xlsx", upload)
+	store.Write(ctx, "parents-kids-classes.xlsx", []byte("roster"))
+
+	runID := RunID(now, upload)
+	if runID != "20241212T153000Z-"+Checksum(upload)[:12] {
+		t.Errorf("unexpected run ID %s", runID)
+	}
+
+	m, err := Save(ctx, store, Manifest{RunID: runID, Created: now}, "2024-12-12-Report.xlsx", "parents-kids-classes.xlsx", "name-corrections.xlsx")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(m.Files) != 2 || m.Files[0].Archived != Prefix+runID+"/2024-12-12-Report.xlsx" || m.Files[0].SHA256 != Checksum(upload) {
+		t.Errorf("unexpected manifest: %+v", m)
+	}
+
+	latest, err := Latest(ctx, store, func(m *Manifest) bool { return true })
+	if err != nil || latest == nil || latest.RunID != runID || latest.Upload().Name != "2024-12-12-Report.xlsx" {
+		t.Errorf("got latest run %+v, %v", latest, err)
+	}
+	if latest, err := Latest(ctx, store, func(m *Manifest) bool { return false }); latest != nil || err != nil {
+		t.Errorf("got latest run %+v, %v, want none", latest, err)
+	}
+
+	// An older run past the retention
+	old := RunID(now.AddDate(0, 0, -400), []byte("old"))
+	store.Write(ctx, Prefix+old+"/2023-11-08-Report.xlsx", []byte("old"))
+	store.Write(ctx, Prefix+old+"/"+ManifestFile, []byte("{}"))
+
+	if pruned, err := Prune(ctx, store, now, 0); err != nil || pruned != nil {
+		t.Errorf("zero retention pruned %v, %v", pruned, err)
+	}
+
+	pruned, err := Prune(ctx, store, now, 365*24*time.Hour)
+	if err != nil || !reflect.DeepEqual(pruned, []string{old}) {
+		t.Errorf("got %v, %v, want %v", pruned, err, old)
+	}
+
+	names, _ := store.List(ctx, Prefix)
+	if len(names) != 3 {
+		t.Errorf("unexpected archive after pruning: %v", names)
+	}
+}
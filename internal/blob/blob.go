@@ -0,0 +1,39 @@
+// Package blob stores the report's input and output files.  The report
+// reads the roster and the transactions and writes the workbook through
+// a Store, so the same code runs against a Cloud Storage bucket in the
+// Cloud Function, a local directory in the CLI and memory in tests.
+package blob
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotExist is returned, possibly wrapped, when reading or deleting a
+// file that isn't in the store.
+var ErrNotExist = errors.New("file does not exist")
+
+// ErrExist is returned, possibly wrapped, by Create when the file is
+// already in the store.
+var ErrExist = errors.New("file already exists")
+
+// ErrChanged is returned, possibly wrapped, by Replace when the file no
+// longer holds what the caller read.
+var ErrChanged = errors.New("file changed")
+
+// Store reads and writes whole files by name.  Names are slash
+// separated, like Cloud Storage object names.
+type Store interface {
+	Read(ctx context.Context, name string) ([]byte, error)
+	Write(ctx context.Context, name string, data []byte) error
+	// Create writes the file only if it doesn't exist yet, atomically,
+	// so that it can be used as a lock.
+	Create(ctx context.Context, name string, data []byte) error
+	// Replace overwrites the file with data only if it still holds old,
+	// atomically, so that a stale lock is taken over by one caller only.
+	Replace(ctx context.Context, name string, old, data []byte) error
+	Delete(ctx context.Context, name string) error
+	// List returns the names of the files whose name starts with
+	// prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
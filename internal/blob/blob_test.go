@@ -0,0 +1,64 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]Store{
+		"Memory": NewMemory(),
+		"Dir":    NewDir(t.TempDir()),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if _, err := store.Read(ctx, "missing.xlsx"); !errors.Is(err, ErrNotExist) {
+				t.Errorf("reading a missing file: got %v, want ErrNotExist", err)
+			}
+
+			if err := store.Write(ctx, "reports/out.xlsx", []byte("report")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			data, err := store.Read(ctx, "reports/out.xlsx")
+			if err != nil || string(data) != "report" {
+				t.Errorf("got %q, %v, want the written file", data, err)
+			}
+
+			if err := store.Write(ctx, "other.xlsx", nil); err != nil {
+				t.Fatal(err)
+			}
+			if names, err := store.List(ctx, "reports/"); err != nil || len(names) != 1 || names[0] != "reports/out.xlsx" {
+				t.Errorf("List: got %v, %v", names, err)
+			}
+
+			if err := store.Create(ctx, "reports/out.xlsx", []byte("other")); !errors.Is(err, ErrExist) {
+				t.Errorf("creating an existing file: got %v, want ErrExist", err)
+			}
+			if err := store.Create(ctx, "locks/out.lock", []byte("first")); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if err := store.Replace(ctx, "locks/out.lock", []byte("first"), []byte("second")); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err := store.Replace(ctx, "locks/out.lock", []byte("first"), []byte("third")); !errors.Is(err, ErrChanged) {
+				t.Errorf("replacing a changed file: got %v, want ErrChanged", err)
+			}
+			if err := store.Replace(ctx, "locks/none.lock", nil, nil); !errors.Is(err, ErrNotExist) {
+				t.Errorf("replacing a missing file: got %v, want ErrNotExist", err)
+			}
+
+			if err := store.Delete(ctx, "reports/out.xlsx"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := store.Delete(ctx, "reports/out.xlsx"); !errors.Is(err, ErrNotExist) {
+				t.Errorf("deleting a missing file: got %v, want ErrNotExist", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Dir stores files in a local directory.
+type Dir struct {
+	root string
+}
+
+// NewDir returns a store for the files under root.
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+// path returns the local path of name.  Absolute paths are used as they
+// are so that a local run can read a file from anywhere.
+func (d *Dir) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(d.root, filepath.FromSlash(name))
+}
+
+func (d *Dir) Read(ctx context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(d.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotExist)
+	}
+	return data, err
+}
+
+// Write creates any missing parent directories of the file.
+func (d *Dir) Write(ctx context.Context, name string, data []byte) error {
+	p := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+func (d *Dir) Create(ctx context.Context, name string, data []byte) error {
+	p := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s: %w", name, ErrExist)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Replace compares and writes the file under a lock held by this process
+// only; a directory is not shared between concurrent runs.
+func (d *Dir) Replace(ctx context.Context, name string, old, data []byte) error {
+	replaceMu.Lock()
+	defer replaceMu.Unlock()
+
+	current, err := d.Read(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, old) {
+		return fmt.Errorf("%s: %w", name, ErrChanged)
+	}
+	return d.Write(ctx, name, data)
+}
+
+// replaceMu serializes Replace across Dir stores.
+var replaceMu sync.Mutex
+
+func (d *Dir) Delete(ctx context.Context, name string) error {
+	err := os.Remove(d.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", name, ErrNotExist)
+	}
+	return err
+}
+
+// List walks the directory; names are relative to it and slash separated.
+func (d *Dir) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(d.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(d.root, p)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	sort.Strings(names)
+	return names, err
+}
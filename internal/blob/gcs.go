@@ -0,0 +1,154 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// GCS stores files as objects of a Cloud Storage bucket.
+type GCS struct {
+	bucket *storage.BucketHandle
+}
+
+// NewGCS returns a store for the named bucket.
+func NewGCS(client *storage.Client, bucket string) *GCS {
+	return &GCS{bucket: client.Bucket(bucket)}
+}
+
+func (s *GCS) Read(ctx context.Context, name string) ([]byte, error) {
+	rc, err := s.bucket.Object(name).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// Write uploads the file.  The upload is only complete once the writer
+// is closed, so an error closing it is a failed write.
+func (s *GCS) Write(ctx context.Context, name string, data []byte) error {
+	w := s.bucket.Object(name).NewWriter(ctx)
+	w.ContentType = contentType(name)
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// Create uploads the file on the condition that no object has the name
+// yet.
+func (s *GCS) Create(ctx context.Context, name string, data []byte) error {
+	w := s.bucket.Object(name).If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+	w.ContentType = contentType(name)
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+
+	err := w.Close()
+	if isPreconditionFailed(err) {
+		return fmt.Errorf("%s: %w", name, ErrExist)
+	}
+	return err
+}
+
+// isPreconditionFailed reports whether the condition of a write didn't
+// hold.
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// Replace uploads the file on the condition that the object is still the
+// generation whose content was compared with old.
+func (s *GCS) Replace(ctx context.Context, name string, old, data []byte) error {
+	obj := s.bucket.Object(name)
+
+	rc, err := obj.NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%s: %w", name, ErrNotExist)
+	}
+	if err != nil {
+		return err
+	}
+	current, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, old) {
+		return fmt.Errorf("%s: %w", name, ErrChanged)
+	}
+
+	w := obj.If(storage.Conditions{GenerationMatch: rc.Attrs.Generation}).NewWriter(ctx)
+	w.ContentType = contentType(name)
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+
+	err = w.Close()
+	if isPreconditionFailed(err) {
+		return fmt.Errorf("%s: %w", name, ErrChanged)
+	}
+	return err
+}
+
+func (s *GCS) Delete(ctx context.Context, name string) error {
+	err := s.bucket.Object(name).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%s: %w", name, ErrNotExist)
+	}
+	return err
+}
+
+func (s *GCS) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	it := s.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, attrs.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// contentTypes are the types of the files the report reads and writes.
+var contentTypes = map[string]string{
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".csv":  "text/csv",
+	".tsv":  "text/tab-separated-values",
+	".json": "application/json",
+}
+
+func contentType(name string) string {
+	if t, ok := contentTypes[path.Ext(name)]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,91 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Memory stores files in memory, for tests.
+type Memory struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{files: make(map[string][]byte)}
+}
+
+func (m *Memory) Read(ctx context.Context, name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotExist)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *Memory) Write(ctx context.Context, name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *Memory) Create(ctx context.Context, name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; ok {
+		return fmt.Errorf("%s: %w", name, ErrExist)
+	}
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *Memory) Replace(ctx context.Context, name string, old, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.files[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", name, ErrNotExist)
+	}
+	if !bytes.Equal(current, old) {
+		return fmt.Errorf("%s: %w", name, ErrChanged)
+	}
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return fmt.Errorf("%s: %w", name, ErrNotExist)
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for name := range m.files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,92 @@
+// Package campaign tags donations with the campaign or fund they were
+// given to.  Exports that mix the annual fund, the auction and other
+// funds either say so in a column or are tagged by the office's rules,
+// so that each campaign can be reported on its own.
+package campaign
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/ingest"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Untagged is the name gifts without a campaign are reported under.
+const Untagged = "Other"
+
+// Tag sets the campaign of the gifts that don't have one to that of the
+// first rule they match.  It returns how many gifts were tagged.
+// Refunds keep the campaign of the gift they reverse, so they are left
+// alone.
+func Tag(rules []types.CampaignRule, donations []*types.DonationTransaction) int {
+	tagged := 0
+	for _, txn := range donations {
+		if txn.Campaign != "" || txn.Amount < 0 {
+			continue
+		}
+		for _, rule := range rules {
+			if Matches(rule, txn) {
+				txn.Campaign = rule.Campaign
+				tagged++
+				break
+			}
+		}
+	}
+	return tagged
+}
+
+// Matches reports whether the gift is dated within the rule's dates and
+// its memo contains the rule's keyword.  A gift whose date can't be read
+// never matches a rule with dates.
+func Matches(rule types.CampaignRule, txn *types.DonationTransaction) bool {
+	if !rule.From.IsZero() || !rule.To.IsZero() {
+		date, ok := ingest.ParseDate(txn.Date)
+		if !ok {
+			return false
+		}
+		date = date.Truncate(24 * time.Hour)
+		if (!rule.From.IsZero() && date.Before(rule.From)) || (!rule.To.IsZero() && date.After(rule.To)) {
+			return false
+		}
+	}
+	if rule.Keyword != "" && !strings.Contains(strings.ToLower(txn.Memo), strings.ToLower(rule.Keyword)) {
+		return false
+	}
+	return true
+}
+
+// Names returns the campaigns of the gifts, in order, with Untagged last
+// when some gifts have no campaign.  Campaigns differing only in case or
+// spacing are one campaign, named as first seen.  It returns nil when no
+// gift has a campaign, as there is then only one.
+func Names(donations []*types.DonationTransaction) []string {
+	seen := make(map[string]bool)
+	var names []string
+	untagged := false
+	for _, txn := range donations {
+		if txn.Campaign == "" {
+			untagged = true
+			continue
+		}
+		key := Key(txn.Campaign)
+		if !seen[key] {
+			seen[key] = true
+			names = append(names, txn.Campaign)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Slice(names, func(i, j int) bool { return Key(names[i]) < Key(names[j]) })
+	if untagged {
+		names = append(names, Untagged)
+	}
+	return names
+}
+
+// Key is how campaign names are compared.
+func Key(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
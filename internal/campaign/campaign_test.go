@@ -0,0 +1,47 @@
+package campaign
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+func TestTag(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC) }
+
+	rules := []types.CampaignRule{
+		{Campaign: "Field Trip", Keyword: "zoo"},
+		{Campaign: "Auction", From: day(3, 1), To: day(3, 15)},
+	}
+
+	donations := []*types.DonationTransaction{
+		{Date: "03/02/2024", Amount: 1000, Memo: "Zoo trip for Sam"},
+		{Date: "03/15/2024 18:30", Amount: 5000},
+		{Date: "03/16/2024", Amount: 2500},
+		{Date: "03/05/2024", Amount: 2500, Campaign: "Annual Fund"},
+		{Date: "03/05/2024", Amount: -1000},
+		{Date: "not a date", Amount: 700},
+	}
+
+	if tagged := Tag(rules, donations); tagged != 2 {
+		t.Errorf("tagged %d gifts, want 2", tagged)
+	}
+
+	var got []string
+	for _, txn := range donations {
+		got = append(got, txn.Campaign)
+	}
+	want := []string{"Field Trip", "Auction", "", "Annual Fund", "", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got campaigns %q, want %q", got, want)
+	}
+
+	if names := Names(donations); !reflect.DeepEqual(names, []string{"Annual Fund", "Auction", "Field Trip", Untagged}) {
+		t.Errorf("unexpected names: %q", names)
+	}
+	if names := Names([]*types.DonationTransaction{{Amount: 100}}); names != nil {
+		t.Errorf("got names %q for gifts without campaigns", names)
+	}
+}
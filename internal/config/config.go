@@ -0,0 +1,238 @@
+// Package config describes which uploads the report runs for and where
+// its files are.  A deployment can serve several schools or campaigns:
+// each Profile accepts the uploads matching its patterns and has its own
+// roster, name corrections and report names.  Profiles are read from
+// File in the store when it exists; otherwise a single profile is made
+// from the environment, with defaults matching the original deployment.
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/blob"
+	"github.com/jotacamou/datacor/internal/report"
+)
+
+// File is the name of the configuration in the store.
+const File = "datacor.json"
+
+// ErrInvalid is returned, wrapped, when the configuration can't be used.
+// Retrying won't fix it.
+var ErrInvalid = errors.New("invalid configuration")
+
+// Defaults of a profile
+const (
+	DefaultInput        = `^\d{4}-\d{2}-\d{2}-Report\.(xlsx|csv|tsv)$`
+	DefaultDatePattern  = `^(\d{4}-\d{2}-\d{2})`
+	DefaultDateLayout   = "2006-01-02"
+	DefaultOutputPrefix = "donations_by_student-"
+)
+
+// Profile configures the reports of one school or campaign.
+type Profile struct {
+	Name string `json:"name,omitempty"`
+	// Inputs are the patterns of the uploads the profile accepts
+	Inputs []string `json:"inputs,omitempty"`
+	// DatePattern finds the date of an upload in its base name, in its
+	// first group, written as DateLayout
+	DatePattern string `json:"date_pattern,omitempty"`
+	DateLayout  string `json:"date_layout,omitempty"`
+	Roster      string `json:"roster,omitempty"`
+	Aliases     string `json:"aliases,omitempty"`
+	Exclusions  string `json:"exclusions,omitempty"`
+	// Goals lists the fundraising goals.  Goals of another campaign
+	// than Name are left out.
+	Goals string `json:"goals,omitempty"`
+	// Campaigns holds the rules tagging gifts with their campaign
+	Campaigns string `json:"campaigns,omitempty"`
+	// Reports are written to OutputFolder as OutputPrefix followed by
+	// the date of the upload
+	OutputPrefix string `json:"output_prefix,omitempty"`
+	OutputFolder string `json:"output_folder,omitempty"`
+
+	inputs []*regexp.Regexp
+	date   *regexp.Regexp
+}
+
+// Config holds the profiles of a deployment.
+type Config struct {
+	Profiles []*Profile `json:"profiles"`
+}
+
+// Load reads the configuration from File in the store, or from the
+// environment when there's no such file.
+func Load(ctx context.Context, store blob.Store) (*Config, error) {
+	data, err := store.Read(ctx, File)
+	if errors.Is(err, blob.ErrNotExist) {
+		return FromEnv()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse reads a configuration file.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", File, ErrInvalid, err)
+	}
+	if len(cfg.Profiles) == 0 {
+		return nil, fmt.Errorf("%s: %w: no profiles", File, ErrInvalid)
+	}
+	for _, p := range cfg.Profiles {
+		if err := p.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %w", File, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// FromEnv makes a single profile from INPUT_PATTERN, DATE_PATTERN,
+// DATE_LAYOUT, ROSTER_FILE, ALIASES_FILE, EXCLUSIONS_FILE, GOALS_FILE,
+// CAMPAIGNS_FILE, OUTPUT_PREFIX and OUTPUT_FOLDER.  Unset variables take
+// their defaults.
+func FromEnv() (*Config, error) {
+	p := &Profile{
+		DatePattern:  os.Getenv("DATE_PATTERN"),
+		DateLayout:   os.Getenv("DATE_LAYOUT"),
+		Roster:       os.Getenv("ROSTER_FILE"),
+		Aliases:      os.Getenv("ALIASES_FILE"),
+		Exclusions:   os.Getenv("EXCLUSIONS_FILE"),
+		Goals:        os.Getenv("GOALS_FILE"),
+		Campaigns:    os.Getenv("CAMPAIGNS_FILE"),
+		OutputPrefix: os.Getenv("OUTPUT_PREFIX"),
+		OutputFolder: os.Getenv("OUTPUT_FOLDER"),
+	}
+	if input := os.Getenv("INPUT_PATTERN"); input != "" {
+		p.Inputs = []string{input}
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return &Config{Profiles: []*Profile{p}}, nil
+}
+
+// compile fills in the defaults of the profile and compiles its patterns.
+func (p *Profile) compile() error {
+	if len(p.Inputs) == 0 {
+		p.Inputs = []string{DefaultInput}
+	}
+	if p.DatePattern == "" {
+		p.DatePattern = DefaultDatePattern
+	}
+	if p.DateLayout == "" {
+		p.DateLayout = DefaultDateLayout
+	}
+	if p.Roster == "" {
+		p.Roster = report.RosterFile
+	}
+	if p.Aliases == "" {
+		p.Aliases = report.AliasesFile
+	}
+	if p.Exclusions == "" {
+		p.Exclusions = report.ExclusionsFile
+	}
+	if p.Goals == "" {
+		p.Goals = report.GoalsFile
+	}
+	if p.Campaigns == "" {
+		p.Campaigns = report.CampaignsFile
+	}
+	if p.OutputPrefix == "" {
+		p.OutputPrefix = DefaultOutputPrefix
+	}
+	if p.OutputFolder != "" && !strings.HasSuffix(p.OutputFolder, "/") {
+		p.OutputFolder += "/"
+	}
+
+	p.inputs = nil
+	for _, input := range p.Inputs {
+		re, err := regexp.Compile(input)
+		if err != nil {
+			return fmt.Errorf("profile %q: %w: input pattern: %v", p.Name, ErrInvalid, err)
+		}
+		p.inputs = append(p.inputs, re)
+	}
+
+	re, err := regexp.Compile(p.DatePattern)
+	if err != nil {
+		return fmt.Errorf("profile %q: %w: date pattern: %v", p.Name, ErrInvalid, err)
+	}
+	if re.NumSubexp() < 1 {
+		return fmt.Errorf("profile %q: %w: date pattern %q has no group for the date", p.Name, ErrInvalid, p.DatePattern)
+	}
+	p.date = re
+
+	return nil
+}
+
+// Find returns the first profile accepting the upload.  Reports are never
+// accepted, so that a broad input pattern doesn't make the function
+// trigger itself with its own output.
+func (c *Config) Find(upload string) (*Profile, bool) {
+	for _, p := range c.Profiles {
+		if strings.HasPrefix(upload, p.OutputFolder+p.OutputPrefix) {
+			return nil, false
+		}
+	}
+	for _, p := range c.Profiles {
+		if p.Accepts(upload) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Accepts reports whether the upload matches any input pattern of the
+// profile.
+func (p *Profile) Accepts(upload string) bool {
+	for _, re := range p.inputs {
+		if re.MatchString(upload) {
+			return true
+		}
+	}
+	return false
+}
+
+// Date returns the date of the upload, found in its base name.
+func (p *Profile) Date(upload string) (time.Time, bool) {
+	m := p.date.FindStringSubmatch(path.Base(upload))
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(p.DateLayout, m[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// OutputName returns the name of the report for an upload, dated like
+// the upload or, when it has no date, like now.
+func (p *Profile) OutputName(upload string, now time.Time) string {
+	date, ok := p.Date(upload)
+	if !ok {
+		date = now
+	}
+	return fmt.Sprintf("%s%s%s.xlsx", p.OutputFolder, p.OutputPrefix, date.Format("2006-01-02"))
+}
+
+// ReportDate returns the date of the upload as shown on the report, or
+// an empty string when it has no date.
+func (p *Profile) ReportDate(upload string) string {
+	date, ok := p.Date(upload)
+	if !ok {
+		return ""
+	}
+	return date.Format("01/02/2006")
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/blob"
+)
+
+func TestDefaults(t *testing.T) {
+	t.Setenv("INPUT_PATTERN", "")
+
+	cfg, err := Load(context.Background(), blob.NewMemory())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, ok := cfg.Find("2024-12-12-Report.xlsx")
+	if !ok || p.Roster != "parents-kids-classes.xlsx" || p.Aliases != "name-corrections.xlsx" || p.Exclusions != "participation-exclusions.xlsx" || p.Goals != "goals.xlsx" || p.Campaigns != "campaigns.xlsx" {
+		t.Fatalf("unexpected profile: %+v, %v", p, ok)
+	}
+	for _, name := range []string{"2024-12-12-Report.csv", "2024-12-12-Report.tsv"} {
+		if _, ok := cfg.Find(name); !ok {
+			t.Errorf("%s not accepted", name)
+		}
+	}
+	for _, name := range []string{"donations_by_student-2024-12-12.xlsx", "2024-12-12-Report.pdf", "notes.txt"} {
+		if _, ok := cfg.Find(name); ok {
+			t.Errorf("%s accepted", name)
+		}
+	}
+
+	now := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := map[string]string{
+		"2024-12-12-Report.xlsx":         "donations_by_student-2024-12-12.xlsx",
+		"exports/2024-11-30-Report.xlsx": "donations_by_student-2024-11-30.xlsx",
+		"transactions.xlsx":              "donations_by_student-2025-01-02.xlsx",
+	}
+	for upload, want := range tests {
+		if got := p.OutputName(upload, now); got != want {
+			t.Errorf("OutputName(%q) = %q, want %q", upload, got, want)
+		}
+	}
+
+	if got := p.ReportDate("2024-12-12-Report.xlsx"); got != "12/12/2024" {
+		t.Errorf("got report date %q, want 12/12/2024", got)
+	}
+	if got := p.ReportDate("transactions.xlsx"); got != "" {
+		t.Errorf("got report date %q for an undated upload", got)
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+	store.Write(ctx, File, []byte(`{
+		"profiles": [
+			{
+				"name": "auction",
+				"inputs": ["^auction/.*\\.xlsx$"],
+				"date_pattern": "_(\\d{8})\\.xlsx$",
+				"date_layout": "20060102",
+				"roster": "auction/roster.xlsx",
+				"output_prefix": "auction-",
+				"output_folder": "auction/reports"
+			},
+			{"name": "annual fund"}
+		]
+	}`))
+
+	cfg, err := Load(ctx, store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, ok := cfg.Find("auction/bids_20241130.xlsx")
+	if !ok || p.Name != "auction" || p.Roster != "auction/roster.xlsx" || p.Aliases != "name-corrections.xlsx" {
+		t.Fatalf("unexpected profile: %+v, %v", p, ok)
+	}
+	if got := p.OutputName("auction/bids_20241130.xlsx", time.Now()); got != "auction/reports/auction-2024-11-30.xlsx" {
+		t.Errorf("got output %q", got)
+	}
+	if _, ok := cfg.Find("auction/reports/auction-2024-11-30.xlsx"); ok {
+		t.Errorf("report accepted as an upload")
+	}
+
+	if p, ok := cfg.Find("2024-12-12-Report.xlsx"); !ok || p.Name != "annual fund" {
+		t.Errorf("unexpected profile: %+v, %v", p, ok)
+	}
+
+	for _, data := range []string{
+		`{`,
+		`{"profiles": []}`,
+		`{"profiles": [{"inputs": ["("]}]}`,
+		`{"profiles": [{"date_pattern": "\\d+"}]}`,
+	} {
+		if _, err := Parse([]byte(data)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: got %v, want ErrInvalid", data, err)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Package history keeps every donation the report has processed in one
+// CSV file in the store.  Donation platforms only export a window of
+// recent transactions, so each export is upserted into the history under
+// a key that stays the same from one export to the next, and reports can
+// cover any period of the history, such as a whole school year.
+package history
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/blob"
+	"github.com/jotacamou/datacor/internal/ingest"
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// File is the name of the history in the store.
+const File = "history/donations.csv"
+
+// header is the first row of the history file.  Histories written
+// before the campaign and memo columns were added are still read.
+var header = []string{"key", "date", "donor", "account", "amount", "students", "upload", "first_seen", "last_seen", "campaign", "memo"}
+
+// oldColumns is the number of columns of the first history files.
+const oldColumns = 9
+
+// Record is a donation kept in the history.
+type Record struct {
+	Key string
+	// Date is written as YYYY-MM-DD when it could be parsed, otherwise
+	// as it was exported
+	Date     string
+	Donor    string
+	Account  string
+	Amount   money.Cents
+	Students []types.StudentRef
+	// Upload is the export the donation was first seen in
+	Upload    string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Campaign and Memo are kept so a period of the history is tagged
+	// with its campaigns like an export is
+	Campaign string
+	Memo     string
+}
+
+// student is a student of a record as written to the history file.
+type student struct {
+	ID     string      `json:"id,omitempty"`
+	Name   string      `json:"name"`
+	Class  string      `json:"class,omitempty"`
+	Amount money.Cents `json:"amount,omitempty"`
+}
+
+// normalizeDate writes a parsed date as YYYY-MM-DD.
+func normalizeDate(s string) string {
+	if t, ok := ingest.ParseDate(s); ok {
+		return t.Format("2006-01-02")
+	}
+	return strings.TrimSpace(s)
+}
+
+// Keys returns the keys of the donations of an export.  A donation with
+// a transaction ID is keyed by it.  Otherwise a key is made of the date,
+// donor, amount and students of the donation, so the same donation on
+// overlapping exports gets the same key.  Identical donations of an
+// export are numbered in order, so two equal gifts on the same day are
+// kept apart.
+func Keys(donations []*types.DonationTransaction) []string {
+	keys := make([]string, len(donations))
+	seen := make(map[string]int)
+
+	for i, txn := range donations {
+		if id := normalize(txn.ID); id != "" {
+			sum := sha256.Sum256([]byte("id:" + id))
+			keys[i] = hex.EncodeToString(sum[:8])
+			continue
+		}
+
+		var students []string
+		for _, ref := range txn.Students {
+			if ref.Name != "" || ref.ID != "" {
+				students = append(students, normalize(ref.ID)+"/"+normalize(ref.Name)+"/"+normalize(ref.Class))
+			}
+		}
+		sort.Strings(students)
+
+		donor := "name:" + normalize(txn.Name)
+		if account := normalize(txn.AccountNumber); account != "" {
+			donor = "account:" + account
+		}
+
+		base := strings.Join([]string{
+			normalizeDate(txn.Date),
+			donor,
+			fmt.Sprint(int64(txn.Amount)),
+			strings.Join(students, ";"),
+		}, "|")
+
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", base, seen[base])))
+		seen[base]++
+		keys[i] = hex.EncodeToString(sum[:8])
+	}
+
+	return keys
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// Upsert adds the donations of an export to the records.  Donations
+// already in the history are only marked as seen again.  It returns the
+// records and how many were added.
+func Upsert(records []Record, upload string, donations []*types.DonationTransaction, now time.Time) ([]Record, int) {
+	index := make(map[string]int, len(records))
+	for i, r := range records {
+		index[r.Key] = i
+	}
+
+	added := 0
+	for i, key := range Keys(donations) {
+		if j, ok := index[key]; ok {
+			records[j].LastSeen = now.UTC()
+			continue
+		}
+
+		txn := donations[i]
+		var students []types.StudentRef
+		for _, ref := range txn.Students {
+			if ref.Name != "" || ref.ID != "" {
+				students = append(students, ref)
+			}
+		}
+
+		index[key] = len(records)
+		records = append(records, Record{
+			Key:       key,
+			Date:      normalizeDate(txn.Date),
+			Donor:     txn.Name,
+			Account:   txn.AccountNumber,
+			Amount:    txn.Amount,
+			Students:  students,
+			Upload:    upload,
+			FirstSeen: now.UTC(),
+			LastSeen:  now.UTC(),
+			Campaign:  txn.Campaign,
+			Memo:      txn.Memo,
+		})
+		added++
+	}
+
+	return records, added
+}
+
+// Select returns the donations of the records dated from from to to,
+// both included, as transactions for a report.  A zero from or to leaves
+// that end open.  Records whose date couldn't be parsed are left out.
+func Select(records []Record, from, to time.Time) []*types.DonationTransaction {
+	donations := []*types.DonationTransaction{}
+	for i, r := range records {
+		date, err := time.Parse("2006-01-02", r.Date)
+		if err != nil {
+			continue
+		}
+		if (!from.IsZero() && date.Before(from)) || (!to.IsZero() && date.After(to)) {
+			continue
+		}
+
+		donations = append(donations, &types.DonationTransaction{
+			Row:           i + 2,
+			Date:          date.Format("01/02/2006"),
+			Name:          r.Donor,
+			Amount:        r.Amount,
+			Students:      append([]types.StudentRef(nil), r.Students...),
+			AccountNumber: r.Account,
+			Campaign:      r.Campaign,
+			Memo:          r.Memo,
+		})
+	}
+	return donations
+}
+
+// Load reads the history from the store.  A missing history is empty.
+func Load(ctx context.Context, store blob.Store) ([]Record, error) {
+	data, err := store.Read(ctx, File)
+	if errors.Is(err, blob.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse reads a history file.
+func Parse(data []byte) ([]Record, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", File, err)
+	}
+
+	var records []Record
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(row) != len(header) && len(row) != oldColumns {
+			return nil, fmt.Errorf("%s row %d: got %d columns, want %d", File, i+1, len(row), len(header))
+		}
+
+		amount, err := money.Parse(row[4])
+		if err != nil {
+			return nil, fmt.Errorf("%s row %d: %w", File, i+1, err)
+		}
+
+		var students []student
+		if row[5] != "" {
+			if err := json.Unmarshal([]byte(row[5]), &students); err != nil {
+				return nil, fmt.Errorf("%s row %d: students: %w", File, i+1, err)
+			}
+		}
+
+		rec := Record{
+			Key:     row[0],
+			Date:    row[1],
+			Donor:   row[2],
+			Account: row[3],
+			Amount:  amount,
+			Upload:  row[6],
+		}
+		for _, s := range students {
+			rec.Students = append(rec.Students, types.StudentRef{ID: s.ID, Name: s.Name, Class: s.Class, Amount: s.Amount})
+		}
+		rec.FirstSeen, _ = time.Parse(time.RFC3339, row[7])
+		rec.LastSeen, _ = time.Parse(time.RFC3339, row[8])
+		if len(row) > oldColumns {
+			rec.Campaign, rec.Memo = row[9], row[10]
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// Save writes the history to the store.
+func Save(ctx context.Context, store blob.Store, records []Record) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, r := range records {
+		students := []student{}
+		for _, ref := range r.Students {
+			students = append(students, student{ID: ref.ID, Name: ref.Name, Class: ref.Class, Amount: ref.Amount})
+		}
+		encoded, err := json.Marshal(students)
+		if err != nil {
+			return err
+		}
+
+		err = w.Write([]string{
+			r.Key,
+			r.Date,
+			r.Donor,
+			r.Account,
+			r.Amount.String(),
+			string(encoded),
+			r.Upload,
+			r.FirstSeen.Format(time.RFC3339),
+			r.LastSeen.Format(time.RFC3339),
+			r.Campaign,
+			r.Memo,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return store.Write(ctx, File, buf.Bytes())
+}
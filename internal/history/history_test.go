@@ -0,0 +1,107 @@
+package history
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/blob"
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+func TestUpsertAndSelect(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+	first := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 1, 0)
+
+	gift := func(date, name string, amount int64, student string) *types.DonationTransaction {
+		return &types.DonationTransaction{Date: date, Name: name, Amount: money.Cents(amount), Students: []types.StudentRef{{Name: student, Class: "K"}}}
+	}
+
+	// Two equal gifts on the same day are two donations
+	november := []*types.DonationTransaction{
+		gift("10/20/2024", "Jane Doe", 2500, "Sam Doe"),
+		gift("10/20/2024", "Jane Doe", 2500, "Sam Doe"),
+	}
+	// The December export overlaps November's
+	december := []*types.DonationTransaction{
+		gift("10/20/2024", "jane  doe", 2500, "Sam Doe"),
+		gift("2024-10-20", "Jane Doe", 2500, "Sam Doe"),
+		gift("11/15/2024", "Uncle Bob", 1000, "Sam Doe"),
+	}
+	december[2].Campaign, december[2].Memo = "Auction", "Paddle raise"
+
+	records, added := Upsert(nil, "2024-11-01-Report.xlsx", november, first)
+	if added != 2 {
+		t.Fatalf("added %d records, want 2", added)
+	}
+	if err := Save(ctx, store, records); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := Load(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, added = Upsert(records, "2024-12-01-Report.xlsx", december, second)
+	if added != 1 || len(records) != 3 {
+		t.Fatalf("added %d records, got %d, want 1 and 3", added, len(records))
+	}
+	if r := records[0]; r.Upload != "2024-11-01-Report.xlsx" || !r.FirstSeen.Equal(first) || !r.LastSeen.Equal(second) {
+		t.Errorf("unexpected record: %+v", r)
+	}
+
+	if err := Save(ctx, store, records); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, records) {
+		t.Errorf("history not read back as written:\n%+v\n%+v", loaded, records)
+	}
+
+	donations := Select(loaded, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 11, 30, 0, 0, 0, 0, time.UTC))
+	if len(donations) != 1 || donations[0].Name != "Uncle Bob" || donations[0].Date != "11/15/2024" || donations[0].Students[0].Name != "Sam Doe" || donations[0].Campaign != "Auction" || donations[0].Memo != "Paddle raise" {
+		t.Errorf("unexpected donations: %+v", donations)
+	}
+	if got := len(Select(loaded, time.Time{}, time.Time{})); got != 3 {
+		t.Errorf("got %d donations for the whole history, want 3", got)
+	}
+}
+
+func TestParseWithoutCampaigns(t *testing.T) {
+	data := []byte("key,date,donor,account,amount,students,upload,first_seen,last_seen\n" +
+		`ab12,2024-10-20,Jane Doe,,$25.00,"[{""name"":""Sam Doe""}]",2024-11-01-Report.xlsx,2024-11-01T12:00:00Z,2024-11-01T12:00:00Z` + "\n")
+
+	records, err := Parse(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Amount != 2500 || records[0].Campaign != "" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
+func TestKeysPreferTransactionID(t *testing.T) {
+	gift := func(id string, amount int64) *types.DonationTransaction {
+		return &types.DonationTransaction{ID: id, Date: "10/20/2024", Name: "Jane Doe", Amount: money.Cents(amount)}
+	}
+
+	// A gift corrected after the export keeps its key; equal gifts with
+	// their own IDs don't depend on their order
+	first := Keys([]*types.DonationTransaction{gift("T-1", 2500), gift("T-2", 2500)})
+	second := Keys([]*types.DonationTransaction{gift("T-2", 2500), gift(" t-1 ", 3000)})
+	if first[0] != second[1] || first[1] != second[0] || first[0] == first[1] {
+		t.Errorf("unexpected keys %v and %v", first, second)
+	}
+
+	// Without an ID the gift is keyed by what it is
+	if keys := Keys([]*types.DonationTransaction{gift("", 2500), gift("", 3000)}); keys[0] == keys[1] || keys[0] == first[0] {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
@@ -0,0 +1,113 @@
+package ingest
+
+import (
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Fields of the name corrections sheet
+const (
+	AliasKind         = "kind"
+	AliasFrom         = "from"
+	AliasFromClass    = "from_class"
+	AliasDonorName    = "donor_name"
+	AliasStudentName  = "student_name"
+	AliasStudentClass = "student_class"
+	AliasStudentID    = "student_id"
+	AliasNote         = "note"
+)
+
+// AliasesSchema describes the columns of the "Data" sheet of
+// name-corrections.xlsx.
+var AliasesSchema = schema.Schema{
+	Name: "name corrections",
+	Columns: []schema.Column{
+		{Field: AliasKind, Aliases: []string{"Type", "Kind", "Correct"}, Required: true},
+		{Field: AliasFrom, Aliases: []string{"As Entered", "From", "Misspelling"}, Required: true},
+		{Field: AliasFromClass, Aliases: []string{"Class As Entered", "From Class"}},
+		{Field: AliasDonorName, Aliases: []string{"Donor Name", "Donor"}},
+		{Field: AliasStudentName, Aliases: []string{"Student Name", "Student"}},
+		{Field: AliasStudentClass, Aliases: []string{"Student Class", "Class"}},
+		{Field: AliasStudentID, Aliases: []string{"Student ID"}},
+		{Field: AliasNote, Aliases: []string{"Note", "Notes", "Comment"}},
+	},
+}
+
+// ParseAliases maps the rows of the name corrections sheet to aliases.
+// The first row must be the header.  Rows that don't say what to correct
+// or what to correct it to are reported as row errors and skipped.
+func ParseAliases(sheet string, rows [][]string) ([]types.Alias, []schema.RowError, error) {
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+
+	m, err := AliasesSchema.Map(sheet, rows[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var aliases []types.Alias
+	var problems []schema.RowError
+
+	for rowIndex, row := range rows {
+		// Skip the header row
+		if rowIndex == 0 || isBlank(row) {
+			continue
+		}
+
+		problem := func(column, reason string) {
+			problems = append(problems, schema.RowError{
+				Sheet:  sheet,
+				Row:    rowIndex + 1,
+				Column: column,
+				Reason: reason,
+			})
+		}
+
+		alias := types.Alias{
+			Row:       rowIndex + 1,
+			From:      m.Value(row, AliasFrom),
+			FromClass: m.Value(row, AliasFromClass),
+			DonorName: m.Value(row, AliasDonorName),
+			Student: types.StudentRef{
+				ID:    m.Value(row, AliasStudentID),
+				Name:  m.Value(row, AliasStudentName),
+				Class: m.Value(row, AliasStudentClass),
+			},
+			Note: m.Value(row, AliasNote),
+		}
+
+		kind := m.Value(row, AliasKind)
+		for _, k := range []types.AliasKind{types.DonorAlias, types.AccountAlias, types.StudentAlias} {
+			if strings.EqualFold(kind, string(k)) {
+				alias.Kind = k
+			}
+		}
+
+		hasStudent := alias.Student.Name != "" || alias.Student.ID != ""
+
+		switch {
+		case alias.Kind == "":
+			problem(m.Header(AliasKind), "unknown correction type "+kind+", row skipped")
+			continue
+		case alias.From == "":
+			problem(m.Header(AliasFrom), "nothing to correct, row skipped")
+			continue
+		case alias.Kind == types.DonorAlias && alias.DonorName == "":
+			problem(m.Header(AliasDonorName), "donor "+alias.From+" has no corrected name, row skipped")
+			continue
+		case alias.Kind == types.StudentAlias && !hasStudent:
+			problem(m.Header(AliasStudentName), "student "+alias.From+" has no corrected name, row skipped")
+			continue
+		case alias.Kind == types.AccountAlias && alias.DonorName == "" && !hasStudent:
+			problem(m.Header(AliasDonorName), "account "+alias.From+" has no donor or student, row skipped")
+			continue
+		}
+
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, problems, nil
+}
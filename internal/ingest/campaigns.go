@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	"time"
+
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Fields of the campaign rules sheet
+const (
+	CampaignName    = "campaign"
+	CampaignFrom    = "from"
+	CampaignTo      = "to"
+	CampaignKeyword = "keyword"
+)
+
+// CampaignsSchema describes the columns of the "Data" sheet of
+// campaigns.xlsx.
+var CampaignsSchema = schema.Schema{
+	Name: "campaign rules",
+	Columns: []schema.Column{
+		{Field: CampaignName, Aliases: []string{"Campaign", "Fund"}, Required: true},
+		{Field: CampaignFrom, Aliases: []string{"From", "Start Date", "Start"}},
+		{Field: CampaignTo, Aliases: []string{"To", "End Date", "End"}},
+		{Field: CampaignKeyword, Aliases: []string{"Memo Keyword", "Keyword"}},
+	},
+}
+
+// ParseCampaignRules maps the rows of the campaign rules sheet to rules,
+// in the order they are tried.  The first row must be the header.  Rows
+// without a campaign, with a date that can't be read, or without any date
+// or keyword to match on are reported as row errors and skipped.
+func ParseCampaignRules(sheet string, rows [][]string) ([]types.CampaignRule, []schema.RowError, error) {
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+
+	m, err := CampaignsSchema.Map(sheet, rows[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rules []types.CampaignRule
+	var problems []schema.RowError
+
+	for rowIndex, row := range rows {
+		// Skip the header row
+		if rowIndex == 0 || isBlank(row) {
+			continue
+		}
+
+		problem := func(column, reason string) {
+			problems = append(problems, schema.RowError{
+				Sheet:  sheet,
+				Row:    rowIndex + 1,
+				Column: column,
+				Reason: reason,
+			})
+		}
+
+		rule := types.CampaignRule{
+			Row:      rowIndex + 1,
+			Campaign: m.Value(row, CampaignName),
+			Keyword:  m.Value(row, CampaignKeyword),
+		}
+
+		if rule.Campaign == "" {
+			problem(m.Header(CampaignName), "no campaign, row skipped")
+			continue
+		}
+
+		valid := true
+		for _, date := range []struct {
+			field string
+			dst   *time.Time
+		}{{CampaignFrom, &rule.From}, {CampaignTo, &rule.To}} {
+			value := m.Value(row, date.field)
+			if value == "" {
+				continue
+			}
+			t, ok := ParseDate(value)
+			if !ok {
+				problem(m.Header(date.field), "unknown date "+value+", row skipped")
+				valid = false
+				break
+			}
+			*date.dst = t
+		}
+		if !valid {
+			continue
+		}
+
+		if rule.From.IsZero() && rule.To.IsZero() && rule.Keyword == "" {
+			problem(m.Header(CampaignName), "campaign "+rule.Campaign+" has no dates or keyword, row skipped")
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, problems, nil
+}
@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Fields of the participation exclusions sheet
+const (
+	ExclusionAccount      = "account"
+	ExclusionCareGiver    = "care_giver"
+	ExclusionStudentName  = "student_name"
+	ExclusionStudentClass = "student_class"
+	ExclusionStudentID    = "student_id"
+	ExclusionReason       = "reason"
+)
+
+// ExclusionsSchema describes the columns of the "Data" sheet of
+// participation-exclusions.xlsx.  Every column is optional but a row
+// must name a family or a student.
+var ExclusionsSchema = schema.Schema{
+	Name: "participation exclusions",
+	Columns: []schema.Column{
+		{Field: ExclusionAccount, Aliases: []string{"Account Number", "Account", "Family Account"}},
+		{Field: ExclusionCareGiver, Aliases: []string{"Care Giver", "Parent Name", "Parent", "Family"}},
+		{Field: ExclusionStudentName, Aliases: []string{"Student Name", "Student"}},
+		{Field: ExclusionStudentClass, Aliases: []string{"Student Class", "Class"}},
+		{Field: ExclusionStudentID, Aliases: []string{"Student ID"}},
+		{Field: ExclusionReason, Aliases: []string{"Reason", "Note", "Notes"}},
+	},
+}
+
+// ParseExclusions maps the rows of the participation exclusions sheet to
+// exclusions.  The first row must be the header.  Rows that don't name a
+// family or a student are reported as row errors and skipped.
+func ParseExclusions(sheet string, rows [][]string) ([]types.Exclusion, []schema.RowError, error) {
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+
+	m, err := ExclusionsSchema.Map(sheet, rows[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var exclusions []types.Exclusion
+	var problems []schema.RowError
+
+	for rowIndex, row := range rows {
+		// Skip the header row
+		if rowIndex == 0 || isBlank(row) {
+			continue
+		}
+
+		exclusion := types.Exclusion{
+			Row:       rowIndex + 1,
+			Account:   m.Value(row, ExclusionAccount),
+			CareGiver: m.Value(row, ExclusionCareGiver),
+			Student: types.StudentRef{
+				ID:    m.Value(row, ExclusionStudentID),
+				Name:  m.Value(row, ExclusionStudentName),
+				Class: m.Value(row, ExclusionStudentClass),
+			},
+			Reason: m.Value(row, ExclusionReason),
+		}
+
+		if exclusion.Account == "" && exclusion.CareGiver == "" && exclusion.Student.Name == "" && exclusion.Student.ID == "" {
+			problems = append(problems, schema.RowError{
+				Sheet:  sheet,
+				Row:    rowIndex + 1,
+				Reason: "no family or student to exclude, row skipped",
+			})
+			continue
+		}
+
+		exclusions = append(exclusions, exclusion)
+	}
+
+	return exclusions, problems, nil
+}
@@ -0,0 +1,94 @@
+package ingest
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Fields of the goals sheet
+const (
+	GoalCampaign = "campaign"
+	GoalClass    = "class"
+	GoalGrade    = "grade"
+	GoalAmount   = "amount"
+)
+
+// GoalsSchema describes the columns of the "Data" sheet of goals.xlsx.
+var GoalsSchema = schema.Schema{
+	Name: "goals",
+	Columns: []schema.Column{
+		{Field: GoalCampaign, Aliases: []string{"Campaign", "Fund"}},
+		{Field: GoalClass, Aliases: []string{"Class", "Classroom"}},
+		{Field: GoalGrade, Aliases: []string{"Grade"}},
+		{Field: GoalAmount, Aliases: []string{"Goal", "Goal Amount", "Target"}, Required: true},
+	},
+}
+
+// ParseGoals maps the rows of the goals sheet to goals.  The first row
+// must be the header.  A row without a class or grade is the goal of the
+// whole school.  Rows with an amount that can't be read, or that repeat
+// the goal of an earlier row, are reported as row errors and skipped.
+func ParseGoals(sheet string, rows [][]string) ([]types.Goal, []schema.RowError, error) {
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+
+	m, err := GoalsSchema.Map(sheet, rows[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var goals []types.Goal
+	var problems []schema.RowError
+	seen := make(map[string]int)
+
+	for rowIndex, row := range rows {
+		// Skip the header row
+		if rowIndex == 0 || isBlank(row) {
+			continue
+		}
+
+		problem := func(column, reason string) {
+			problems = append(problems, schema.RowError{
+				Sheet:  sheet,
+				Row:    rowIndex + 1,
+				Column: column,
+				Reason: reason,
+			})
+		}
+
+		goal := types.Goal{
+			Row:      rowIndex + 1,
+			Campaign: m.Value(row, GoalCampaign),
+			Class:    m.Value(row, GoalClass),
+			Grade:    m.Value(row, GoalGrade),
+		}
+
+		if goal.Class != "" && goal.Grade != "" {
+			problem(m.Header(GoalGrade), "goal names both class "+goal.Class+" and grade "+goal.Grade+", row skipped")
+			continue
+		}
+
+		amount, err := money.Parse(m.Value(row, GoalAmount))
+		if err != nil || amount <= 0 {
+			problem(m.Header(GoalAmount), "goal amount "+m.Value(row, GoalAmount)+" is not a positive amount, row skipped")
+			continue
+		}
+		goal.Amount = amount
+
+		key := strings.ToLower(strings.Join([]string{goal.Campaign, goal.Class, goal.Grade}, "|"))
+		if first, ok := seen[key]; ok {
+			problem(m.Header(GoalAmount), "goal already set on row "+strconv.Itoa(first)+", row skipped")
+			continue
+		}
+		seen[key] = goal.Row
+
+		goals = append(goals, goal)
+	}
+
+	return goals, problems, nil
+}
@@ -0,0 +1,310 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTransactions(t *testing.T) {
+	rows := [][]string{
+		{"Account Number", "Date", "Donor Name", "Amount", "Student Name", "Student Class", "Second Student Name"},
+		{"", "", "Total", "$30.00"},
+		{"A1", "12/01/2024", "Jane Doe", "$20.00", "Sam Lee", "K", "Ana Lee"},
+		{"A2", "12/02/2024", "Uncle Bob", "$10.00"},
+		{"A3", "12/03/2024", "Aunt May", "ten dollars"},
+		{},
+	}
+
+	donations, problems, err := ParseTransactions("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(donations) != 2 {
+		t.Fatalf("got %d donations, want 2", len(donations))
+	}
+
+	if len(problems) != 1 || problems[0].Row != 5 || problems[0].Column != "Amount" {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+
+	txn := donations[0]
+	if txn.Amount != 2000 {
+		t.Errorf("got amount %d, want 2000", txn.Amount)
+	}
+	if txn.Name != "Jane Doe" || !reflect.DeepEqual(txn.StudentNames(), []string{"Sam Lee", "Ana Lee"}) || txn.AccountNumber != "A1" {
+		t.Errorf("unexpected transaction: %+v", txn)
+	}
+
+	if got := WithoutStudents(donations); len(got) != 1 || got[0].Name != "Uncle Bob" {
+		t.Errorf("WithoutStudents: got %+v", got)
+	}
+}
+
+func TestParseTransactionsMissingColumns(t *testing.T) {
+	rows := [][]string{{"Date", "Donor Name", "Student Name"}}
+
+	if _, _, err := ParseTransactions("Data", rows); err == nil {
+		t.Errorf("expected an error for the missing Amount column")
+	}
+}
+
+func TestParseRoster(t *testing.T) {
+	rows := [][]string{
+		{"Parent Name", "Child 1 Name", "Child 1 Class", "Child 2 Name", "Child 2 Class", "Child 3 Name", "Child 3 Class", "Account Number", "Child 4 Name", "Child 4 Class"},
+		{"Jane Doe", "Sam Lee", "K"},
+		{"John Lee", "Sam Lee", "K", "Ana Lee", "2", "", "", "A1", "Bo Lee", "3"},
+		{},
+		{"", "Max Roe", "1"},
+		{"Pat Roe", "Max Roe"},
+	}
+
+	parents, problems, err := ParseRoster("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(parents) != 3 {
+		t.Fatalf("got %d parents, want 3", len(parents))
+	}
+	if len(parents[1].Children) != 3 || parents[1].AccountNumber != "A1" {
+		t.Errorf("unexpected parent: %+v", parents[1])
+	}
+
+	graded, _, err := ParseRoster("Data", [][]string{
+		{"Parent Name", "Child Name", "Child Class", "Child Grade"},
+		{"Jane Doe", "Sam Lee", "Room 4", "K"},
+	})
+	if err != nil || graded[0].Children[0].Grade != "K" {
+		t.Errorf("grade not read: %+v, %v", graded, err)
+	}
+
+	if len(problems) != 2 {
+		t.Fatalf("got %d problems, want 2: %v", len(problems), problems)
+	}
+	if problems[0].Row != 5 || problems[0].Column != "Parent Name" {
+		t.Errorf("unexpected problem: %+v", problems[0])
+	}
+	if problems[1].Row != 6 || problems[1].Column != "Child 1 Class" {
+		t.Errorf("unexpected problem: %+v", problems[1])
+	}
+}
+
+func TestParseTransactionsManySiblings(t *testing.T) {
+	rows := [][]string{
+		{"Date", "Donor Name", "Amount", "First Student Name", "Second Student Name", "Third Student Name", "Student 4 Name", "Student 4 Class"},
+		{},
+		{"12/01/2024", "Jane Doe", "$40.00", "A", "B", "C", "D", "K"},
+	}
+
+	donations, _, err := ParseTransactions("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	students := donations[0].Students
+	if len(students) != 4 || students[3].Name != "D" || students[3].Class != "K" {
+		t.Errorf("unexpected students: %+v", students)
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	rows := [][]string{
+		{"Type", "As Entered", "Class As Entered", "Donor Name", "Student Name", "Student Class", "Note"},
+		{"donor", "Jhon Doe", "", "John Doe"},
+		{"Student", "Jonny Smith", "K", "", "Jonathan Smith", "K", "Goes by Jonny"},
+		{"Account", "A1", "", "", "Sam Lee", "2"},
+		{"Donor", "Bob"},
+		{"Teacher", "Ms. Roe"},
+		{},
+	}
+
+	aliases, problems, err := ParseAliases("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(aliases) != 3 {
+		t.Fatalf("got %d aliases, want 3: %+v", len(aliases), aliases)
+	}
+	if a := aliases[1]; a.Row != 3 || a.FromClass != "K" || a.Student.Name != "Jonathan Smith" || a.Note != "Goes by Jonny" {
+		t.Errorf("unexpected alias: %+v", a)
+	}
+	if len(problems) != 2 || problems[0].Row != 5 || problems[1].Column != "Type" {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+}
+
+func TestParseExclusions(t *testing.T) {
+	rows := [][]string{
+		{"Account Number", "Care Giver", "Student Name", "Class", "Reason"},
+		{"A7", "", "", "", "Scholarship"},
+		{"", "Jane Doe"},
+		{"", "", "Sam Lee", "2", "New this week"},
+		{"", "", "", "K", "No one named"},
+		{},
+	}
+
+	exclusions, problems, err := ParseExclusions("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(exclusions) != 3 {
+		t.Fatalf("got %d exclusions, want 3: %+v", len(exclusions), exclusions)
+	}
+	if e := exclusions[0]; e.Row != 2 || e.Account != "A7" || e.Reason != "Scholarship" {
+		t.Errorf("unexpected exclusion: %+v", e)
+	}
+	if e := exclusions[2]; e.Student.Name != "Sam Lee" || e.Student.Class != "2" {
+		t.Errorf("unexpected exclusion: %+v", e)
+	}
+	if len(problems) != 1 || problems[0].Row != 5 {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+}
+
+func TestParseGoals(t *testing.T) {
+	rows := [][]string{
+		{"Campaign", "Class", "Grade", "Goal"},
+		{"", "", "", "$10,000"},
+		{"Annual Fund", "K-Rivera", "", "$500"},
+		{"", "", "3", "1200"},
+		{"", "k-rivera", "K", "$500"},
+		{"annual fund", "K-Rivera", "", "$600"},
+		{"", "3A", "", "lots"},
+	}
+
+	goals, problems, err := ParseGoals("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(goals) != 3 {
+		t.Fatalf("got %d goals, want 3: %+v", len(goals), goals)
+	}
+	if g := goals[0]; g.Class != "" || g.Grade != "" || g.Amount != 1000000 {
+		t.Errorf("unexpected school goal: %+v", g)
+	}
+	if g := goals[1]; g.Campaign != "Annual Fund" || g.Class != "K-Rivera" || g.Amount != 50000 {
+		t.Errorf("unexpected class goal: %+v", g)
+	}
+	if len(problems) != 3 || problems[0].Row != 5 || problems[1].Row != 6 || problems[2].Column != "Goal" {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+}
+
+func TestParseTransactionsCampaign(t *testing.T) {
+	rows := [][]string{
+		{"Date", "Donor Name", "Amount", "Student Name", "Fund", "Memo"},
+		{"", "Total", "$30.00"},
+		{"03/02/2024", "Jane Doe", "$20.00", "Sam Lee", "Auction", "Paddle raise"},
+		{"03/03/2024", "Uncle Bob", "$10.00"},
+	}
+
+	donations, _, err := ParseTransactions("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(donations) != 2 || donations[0].Campaign != "Auction" || donations[0].Memo != "Paddle raise" || donations[1].Campaign != "" {
+		t.Errorf("unexpected donations: %+v", donations)
+	}
+}
+
+func TestParseCampaignRules(t *testing.T) {
+	rows := [][]string{
+		{"Campaign", "Start Date", "End Date", "Memo Keyword"},
+		{"Auction", "03/01/2024", "03/15/2024"},
+		{"Field Trip", "", "", "zoo"},
+		{"", "03/01/2024"},
+		{"Gala", "someday"},
+		{"Annual Fund"},
+	}
+
+	rules, problems, err := ParseCampaignRules("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2: %+v", len(rules), rules)
+	}
+	if r := rules[0]; r.Campaign != "Auction" || r.From.Day() != 1 || r.To.Day() != 15 {
+		t.Errorf("unexpected rule: %+v", r)
+	}
+	if r := rules[1]; r.Keyword != "zoo" || !r.From.IsZero() {
+		t.Errorf("unexpected rule: %+v", r)
+	}
+	if len(problems) != 3 || problems[1].Column != "Start Date" || problems[2].Row != 6 {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+}
+
+func TestParseTransactionsStudentAmounts(t *testing.T) {
+	rows := [][]string{
+		{"Date", "Donor Name", "Amount", "Student 1 Name", "Student 1 Amount", "Student 2 Name", "Student 2 Amount"},
+		{"", "Total", "$90.00"},
+		{"12/01/2024", "Jane Doe", "$90.00", "Sam Lee", "$60.00", "Ana Lee", "thirty"},
+	}
+
+	donations, problems, err := ParseTransactions("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(donations) != 1 || donations[0].Students[0].Amount != 6000 || donations[0].Students[1].Amount != 0 {
+		t.Fatalf("unexpected donations: %+v", donations)
+	}
+	if len(problems) != 1 || problems[0].Column != "Student 2 Amount" {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+}
+
+func TestParseTransactionsID(t *testing.T) {
+	rows := [][]string{
+		{"Transaction ID", "Date", "Donor Name", "Amount", "Student Name"},
+		{"", "", "Total", "$30.00"},
+		{"T-1001", "03/02/2024", "Jane Doe", "$20.00", "Sam Lee"},
+		{"", "03/03/2024", "Uncle Bob", "$10.00", "Sam Lee"},
+	}
+
+	donations, _, err := ParseTransactions("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(donations) != 2 || donations[0].ID != "T-1001" || donations[1].ID != "" {
+		t.Errorf("unexpected donations: %+v", donations)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	for _, s := range []string{"03/02/2024", "3/2/2024", "2024-03-02", " 03/02/2024 14:30", "03-02-24"} {
+		if got, ok := ParseDate(s); !ok || got.Format("2006-01-02") != "2024-03-02" {
+			t.Errorf("ParseDate(%q) = %v, %v", s, got, ok)
+		}
+	}
+	if _, ok := ParseDate("March 2nd"); ok {
+		t.Error("unexpected date parsed from March 2nd")
+	}
+}
+
+func TestParseTransactionsWithoutTotals(t *testing.T) {
+	// The first donation follows the header, and the totals come last
+	rows := [][]string{
+		{"Date", "Donor Name", "Amount", "Student Name"},
+		{"03/02/2024", "Jane Doe", "$20.00", "Sam Lee"},
+		{"03/03/2024", "Uncle Bob", "$10.00", "Sam Lee"},
+		{"", "Grand Total", "$30.00"},
+	}
+
+	donations, problems, err := ParseTransactions("Data", rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(donations) != 2 || donations[0].Name != "Jane Doe" || donations[0].Row != 2 || len(problems) != 0 {
+		t.Errorf("unexpected donations %+v, problems %v", donations, problems)
+	}
+}
@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Fields of the parents, kids and classes roster
+const (
+	RosterParentName    = "parent_name"
+	RosterChildName     = "child_name"
+	RosterChildClass    = "child_class"
+	RosterChildID       = "child_id"
+	RosterChildGrade    = "child_grade"
+	RosterAccountNumber = "account_number"
+)
+
+// RosterSchema describes the columns of the "Data" sheet of
+// parents-kids-classes.xlsx.
+var RosterSchema = schema.Schema{
+	Name: "roster",
+	Columns: []schema.Column{
+		{Field: RosterParentName, Aliases: []string{"Parent Name", "Parent", "Care Giver", "Caregiver", "Name"}, Required: true},
+		{Field: RosterChildName, Aliases: []string{"Child # Name", "Child Name", "# Child Name", "Student # Name", "Student Name", "# Student Name"}, Required: true, Repeated: true},
+		{Field: RosterChildClass, Aliases: []string{"Child # Class", "Child Class", "# Child Class", "Student # Class", "Student Class", "# Student Class"}, Required: true, Repeated: true},
+		{Field: RosterChildID, Aliases: []string{"Child # ID", "Child ID", "# Child ID", "Student # ID", "Student ID", "# Student ID"}, Repeated: true},
+		{Field: RosterChildGrade, Aliases: []string{"Child # Grade", "Child Grade", "# Child Grade", "Student # Grade", "Student Grade", "# Student Grade"}, Repeated: true},
+		{Field: RosterAccountNumber, Aliases: []string{"Account Number", "Account", "Account #"}},
+	},
+}
+
+// ParseRoster maps the rows of the roster sheet to parents and their
+// children.  The first row must be the header.  Rows that can't be used
+// as-is are reported as row errors instead of failing the whole roster;
+// an error is only returned when the header itself is unusable.
+func ParseRoster(sheet string, rows [][]string) ([]*types.Parent, []schema.RowError, error) {
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+
+	m, err := RosterSchema.Map(sheet, rows[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var parents []*types.Parent
+	var problems []schema.RowError
+
+	for rowIndex, row := range rows {
+		// Skip the header row
+		if rowIndex == 0 {
+			continue
+		}
+
+		if isBlank(row) {
+			continue
+		}
+
+		problem := func(column, reason string) {
+			problems = append(problems, schema.RowError{
+				Sheet:  sheet,
+				Row:    rowIndex + 1,
+				Column: column,
+				Reason: reason,
+			})
+		}
+
+		parent := &types.Parent{
+			Name:          m.Value(row, RosterParentName),
+			AccountNumber: m.Value(row, RosterAccountNumber),
+		}
+
+		// A parent can have any number of children in the school
+		for _, n := range childNumbers(m) {
+			name := m.RepeatedValue(row, RosterChildName, n)
+			class := m.RepeatedValue(row, RosterChildClass, n)
+
+			switch {
+			case name == "" && class == "":
+				continue
+			case name == "":
+				problem(m.RepeatedHeader(RosterChildName, n), "class "+class+" has no student name")
+				continue
+			case class == "":
+				problem(m.RepeatedHeader(RosterChildClass, n), "student "+name+" has no class")
+			}
+
+			parent.Children = append(parent.Children, types.Student{
+				ID:    m.RepeatedValue(row, RosterChildID, n),
+				Name:  name,
+				Grade: m.RepeatedValue(row, RosterChildGrade, n),
+				Class: class,
+			})
+		}
+
+		if parent.Name == "" {
+			problem(m.Header(RosterParentName), "missing parent name, row skipped")
+			continue
+		}
+
+		if len(parent.Children) == 0 {
+			problem(m.Header(RosterChildName), "parent "+parent.Name+" has no students, row skipped")
+			continue
+		}
+
+		parents = append(parents, parent)
+	}
+
+	return parents, problems, nil
+}
+
+// childNumbers returns the numbers of every child column group found in
+// the roster header, whether only the name or only the class was found.
+func childNumbers(m *schema.Mapping) []int {
+	seen := make(map[int]bool)
+	var numbers []int
+	for _, field := range []string{RosterChildName, RosterChildClass} {
+		for _, n := range m.Numbers(field) {
+			if !seen[n] {
+				seen[n] = true
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// isBlank reports whether every cell of row is empty.
+func isBlank(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
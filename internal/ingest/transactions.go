@@ -0,0 +1,169 @@
+// Package ingest turns the rows of the input spreadsheets into the
+// records used to build the donations by student report.
+package ingest
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Fields of the transactions export
+const (
+	TxnDate          = "date"
+	TxnDonorName     = "donor_name"
+	TxnAmount        = "amount"
+	TxnStudentName   = "student_name"
+	TxnStudentClass  = "student_class"
+	TxnStudentID     = "student_id"
+	TxnStudentAmount = "student_amount"
+	TxnAccountNumber = "account_number"
+	TxnCampaign      = "campaign"
+	TxnMemo          = "memo"
+	TxnID            = "transaction_id"
+)
+
+// TransactionsSchema describes the columns of the "Data" sheet of the
+// transactions export from the donation platform.
+var TransactionsSchema = schema.Schema{
+	Name: "transactions",
+	Columns: []schema.Column{
+		{Field: TxnDate, Aliases: []string{"Date", "Transaction Date", "Donation Date"}, Required: true},
+		{Field: TxnDonorName, Aliases: []string{"Donor Name", "Name", "Donor"}, Required: true},
+		{Field: TxnAmount, Aliases: []string{"Amount", "Donation Amount", "Gift Amount"}, Required: true},
+		{Field: TxnStudentName, Aliases: []string{"Student # Name", "Student Name", "# Student Name", "Student Name #"}, Required: true, Repeated: true},
+		{Field: TxnStudentClass, Aliases: []string{"Student # Class", "Student Class", "# Student Class", "Student Class #"}, Repeated: true},
+		{Field: TxnStudentID, Aliases: []string{"Student # ID", "Student ID", "# Student ID", "Student ID #"}, Repeated: true},
+		{Field: TxnStudentAmount, Aliases: []string{"Student # Amount", "Student Amount", "# Student Amount", "Student Amount #"}, Repeated: true},
+		{Field: TxnAccountNumber, Aliases: []string{"Account Number", "Account", "Account #"}},
+		{Field: TxnCampaign, Aliases: []string{"Campaign", "Fund", "Designation"}},
+		{Field: TxnMemo, Aliases: []string{"Memo", "Note", "Notes", "Comment"}},
+		{Field: TxnID, Aliases: []string{"Transaction ID", "Transaction #", "Transaction Number", "Donation ID", "Gift ID"}},
+	},
+}
+
+// ParseTransactions maps the rows of the transactions sheet to donation
+// transactions.  The first row must be the header.  The totals computed
+// by the donation platform are skipped: a row for a "Total" donor, or a
+// row without a date right after the header.  Not every export has one.
+// Rows whose amount can't be parsed are reported as row errors and left out,
+// rather than being counted as zero dollar donations.
+func ParseTransactions(sheet string, rows [][]string) ([]*types.DonationTransaction, []schema.RowError, error) {
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+
+	m, err := TransactionsSchema.Map(sheet, rows[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var donations []*types.DonationTransaction
+	var problems []schema.RowError
+
+	for rowIndex, row := range rows {
+		// Skip the header row
+		if rowIndex == 0 || isBlank(row) {
+			continue
+		}
+
+		if isTotals(m, row, rowIndex) {
+			continue
+		}
+
+		amount, err := money.Parse(m.Value(row, TxnAmount))
+		if err != nil {
+			problems = append(problems, schema.RowError{
+				Sheet:  sheet,
+				Row:    rowIndex + 1,
+				Column: m.Header(TxnAmount),
+				Reason: err.Error() + ", donation from " + m.Value(row, TxnDonorName) + " skipped",
+			})
+			continue
+		}
+
+		txn := &types.DonationTransaction{
+			Row:           rowIndex + 1,
+			Date:          m.Value(row, TxnDate),
+			Name:          m.Value(row, TxnDonorName),
+			Amount:        amount,
+			AccountNumber: m.Value(row, TxnAccountNumber),
+			Campaign:      m.Value(row, TxnCampaign),
+			Memo:          m.Value(row, TxnMemo),
+			ID:            m.Value(row, TxnID),
+		}
+
+		// A donation can be for any number of siblings
+		for _, n := range m.Numbers(TxnStudentName) {
+			student := types.StudentRef{
+				ID:    m.RepeatedValue(row, TxnStudentID, n),
+				Name:  m.RepeatedValue(row, TxnStudentName, n),
+				Class: m.RepeatedValue(row, TxnStudentClass, n),
+			}
+			if student.Name == "" {
+				continue
+			}
+			if value := m.RepeatedValue(row, TxnStudentAmount, n); value != "" {
+				share, err := money.Parse(value)
+				if err != nil {
+					problems = append(problems, schema.RowError{
+						Sheet:  sheet,
+						Row:    rowIndex + 1,
+						Column: m.RepeatedHeader(TxnStudentAmount, n),
+						Reason: err.Error() + ", amount for " + student.Name + " ignored",
+					})
+				}
+				student.Amount = share
+			}
+			txn.Students = append(txn.Students, student)
+		}
+
+		donations = append(donations, txn)
+	}
+
+	return donations, problems, nil
+}
+
+// WithoutStudents returns the gifts that don't name any student.
+// Refunds are left out since they are reported on their own.
+func WithoutStudents(donations []*types.DonationTransaction) []*types.DonationTransaction {
+	var filtered []*types.DonationTransaction
+	for _, txn := range donations {
+		if txn.Amount < 0 {
+			continue
+		}
+		// Ignore transactions with students associated with them
+		if len(txn.StudentNames()) > 0 {
+			continue
+		}
+		filtered = append(filtered, txn)
+	}
+	return filtered
+}
+
+// isTotals reports whether the row holds the totals of the export rather
+// than a donation.
+func isTotals(m *schema.Mapping, row []string, rowIndex int) bool {
+	switch strings.ToLower(strings.Join(strings.Fields(m.Value(row, TxnDonorName)), " ")) {
+	case "total", "totals", "grand total":
+		return true
+	}
+	return rowIndex == 1 && m.Value(row, TxnDate) == ""
+}
+
+// dateLayouts are the date formats found in the exports.
+var dateLayouts = []string{"01/02/2006", "1/2/2006", "2006-01-02", "01/02/2006 15:04", "1/2/2006 15:04", "01-02-06", "1-2-06"}
+
+// ParseDate parses the date of a donation as exported.
+func ParseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
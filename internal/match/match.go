@@ -0,0 +1,297 @@
+// Package match resolves the students named on donation transactions to
+// the students of the roster.  Donors type student names by hand on the
+// donation form, so besides exact matches the index tries normalized,
+// nickname and edit-distance matches, constrained by class, and records
+// how confident each match is so that a volunteer can review it.
+package match
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Method is the way a student was matched.
+type Method string
+
+const (
+	Unmatched  Method = "Unmatched"
+	ByID       Method = "Student ID"
+	Exact      Method = "Exact"
+	Normalized Method = "Normalized"
+	Nickname   Method = "Nickname"
+	Fuzzy      Method = "Fuzzy"
+)
+
+// MinSimilarity is the lowest edit-distance similarity accepted as a
+// fuzzy match.
+const MinSimilarity = 0.8
+
+// Match is the roster student a transaction refers to.
+type Match struct {
+	Key     string
+	Student types.Student
+	Method  Method
+	// Confidence goes from 0 for no match to 1 for an exact match
+	Confidence float64
+	// Reason explains why a student wasn't matched
+	Reason string
+}
+
+// Index looks up roster students by ID and by name.
+type Index struct {
+	byID      map[string]string
+	byName    map[string][]string
+	byAccount map[string][]string
+	students  types.AllStudents
+}
+
+// NewIndex indexes every student of the roster.
+func NewIndex(students types.AllStudents) *Index {
+	idx := &Index{
+		byID:      make(map[string]string),
+		byName:    make(map[string][]string),
+		byAccount: make(map[string][]string),
+		students:  students,
+	}
+	for key, student := range students {
+		if student.ID != "" {
+			idx.byID[normalize(student.ID)] = key
+		}
+		name := normalize(student.Name)
+		idx.byName[name] = append(idx.byName[name], key)
+		for _, account := range student.Accounts {
+			account = normalize(account)
+			idx.byAccount[account] = append(idx.byAccount[account], key)
+		}
+	}
+	for _, keys := range idx.byAccount {
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := students[keys[i]], students[keys[j]]
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			return keys[i] < keys[j]
+		})
+	}
+	return idx
+}
+
+// Family returns the roster students of a family account, ordered by
+// name.
+func (idx *Index) Family(account string) []types.StudentRef {
+	if account == "" {
+		return nil
+	}
+	var refs []types.StudentRef
+	for _, key := range idx.byAccount[normalize(account)] {
+		student := idx.students[key]
+		refs = append(refs, types.StudentRef{ID: student.ID, Name: student.Name, Class: student.Class})
+	}
+	return refs
+}
+
+// Resolve returns the key of the roster student a transaction refers to.
+func (idx *Index) Resolve(ref types.StudentRef) (string, bool) {
+	m := idx.Match(ref)
+	return m.Key, m.Method != Unmatched
+}
+
+// Match finds the roster student a transaction refers to.  The student
+// ID is used when the transaction has one.  Otherwise names are compared
+// exactly, then normalized (accents, punctuation and middle names
+// ignored), then by nickname and finally by edit distance.  The class
+// tells apart students with the same name, and fuzzy matches are only
+// looked for in the class given on the transaction.  A name that could
+// be more than one student is left unmatched.
+func (idx *Index) Match(ref types.StudentRef) Match {
+	if ref.ID != "" {
+		if key, ok := idx.byID[normalize(ref.ID)]; ok {
+			return idx.found(key, ByID, 1)
+		}
+	}
+
+	if m, ok := idx.pick(ref, idx.byName[normalize(ref.Name)], Exact, 1); ok {
+		return m
+	}
+
+	var normalized, nicknamed []string
+	for key, student := range idx.students {
+		switch {
+		case simplify(student.Name) == simplify(ref.Name):
+			normalized = append(normalized, key)
+		case sameByNickname(student.Name, ref.Name):
+			nicknamed = append(nicknamed, key)
+		}
+	}
+
+	if m, ok := idx.pick(ref, normalized, Normalized, 0.95); ok {
+		return m
+	}
+	if m, ok := idx.pick(ref, nicknamed, Nickname, 0.85); ok {
+		return m
+	}
+
+	return idx.fuzzy(ref)
+}
+
+// pick returns the single candidate, using the class to choose among
+// several.  It fails when there's no candidate or the class doesn't
+// settle which one is meant.
+func (idx *Index) pick(ref types.StudentRef, candidates []string, method Method, confidence float64) (Match, bool) {
+	if ref.Class != "" && len(candidates) > 1 {
+		var sameClass []string
+		for _, key := range candidates {
+			if normalize(idx.students[key].Class) == normalize(ref.Class) {
+				sameClass = append(sameClass, key)
+			}
+		}
+		candidates = sameClass
+	}
+
+	if len(candidates) != 1 {
+		return Match{}, false
+	}
+	return idx.found(candidates[0], method, confidence), true
+}
+
+// fuzzy looks for the most similar name by edit distance.  When the
+// class is known only students of that class are considered.
+func (idx *Index) fuzzy(ref types.StudentRef) Match {
+	name := simplify(ref.Name)
+	inClass := idx.inClass(ref.Class)
+
+	best, bestScore, tied := "", 0.0, false
+	for key, student := range idx.students {
+		if inClass && normalize(student.Class) != normalize(ref.Class) {
+			continue
+		}
+		score := similarity(name, simplify(student.Name))
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = key, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+
+	switch {
+	case bestScore < MinSimilarity:
+		return Match{Method: Unmatched, Reason: "no student with a similar name"}
+	case tied:
+		return Match{Method: Unmatched, Reason: "more than one student with a similar name"}
+	}
+	return idx.found(best, Fuzzy, bestScore)
+}
+
+// inClass reports whether any roster student is in class.
+func (idx *Index) inClass(class string) bool {
+	if class == "" {
+		return false
+	}
+	for _, student := range idx.students {
+		if normalize(student.Class) == normalize(class) {
+			return true
+		}
+	}
+	return false
+}
+
+func (idx *Index) found(key string, method Method, confidence float64) Match {
+	return Match{
+		Key:        key,
+		Student:    idx.students[key],
+		Method:     method,
+		Confidence: confidence,
+	}
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// accents maps accented letters to their plain form.
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "ä", "a", "â", "a", "ã", "a",
+	"é", "e", "è", "e", "ë", "e", "ê", "e",
+	"í", "i", "ì", "i", "ï", "i", "î", "i",
+	"ó", "o", "ò", "o", "ö", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ù", "u", "ü", "u", "û", "u",
+	"ñ", "n", "ç", "c",
+)
+
+// simplify lowercases a name, removes accents and punctuation and keeps
+// only the first and last names.
+func simplify(name string) string {
+	name = accents.Replace(strings.ToLower(name))
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			return r
+		case r == '\'' || r == '.':
+			return -1
+		}
+		return ' '
+	}, name)
+
+	parts := strings.Fields(name)
+	if len(parts) > 2 {
+		parts = []string{parts[0], parts[len(parts)-1]}
+	}
+	return strings.Join(parts, " ")
+}
+
+// sameByNickname reports whether both names have the same last name and
+// first names that are nicknames of one another.
+func sameByNickname(a, b string) bool {
+	pa := strings.Fields(simplify(a))
+	pb := strings.Fields(simplify(b))
+	if len(pa) < 2 || len(pb) < 2 || pa[len(pa)-1] != pb[len(pb)-1] {
+		return false
+	}
+
+	first, other := pa[0], pb[0]
+	for _, group := range nicknames {
+		if group[first] && group[other] {
+			return true
+		}
+	}
+	return false
+}
+
+// similarity returns 1 minus the edit distance between the names,
+// relative to the length of the longest one.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the number of single letter insertions, deletions
+// and substitutions needed to turn a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
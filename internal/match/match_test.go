@@ -0,0 +1,57 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+func TestMatch(t *testing.T) {
+	students := make(types.AllStudents)
+	for _, student := range []types.Student{
+		{Name: "Jonathan Smith", Class: "K"},
+		{Name: "José Ramírez", Class: "2"},
+		{Name: "Sam Lee", Class: "K"},
+		{Name: "Sam Lee", Class: "3"},
+		{Name: "Katherine O'Neil", Class: "4"},
+		{ID: "S42", Name: "Ana Roe", Class: "1"},
+	} {
+		students[student.Key()] = student
+	}
+
+	idx := NewIndex(students)
+
+	tests := []struct {
+		name    string
+		ref     types.StudentRef
+		method  Method
+		student string
+		class   string
+	}{
+		{"Exact", types.StudentRef{Name: "jonathan  smith"}, Exact, "Jonathan Smith", "K"},
+		{"By ID", types.StudentRef{ID: "s42", Name: "Anna"}, ByID, "Ana Roe", "1"},
+		{"Same name told apart by class", types.StudentRef{Name: "Sam Lee", Class: "3"}, Exact, "Sam Lee", "3"},
+		{"Same name without class", types.StudentRef{Name: "Sam Lee"}, Unmatched, "", ""},
+		{"Accents", types.StudentRef{Name: "Jose Ramirez"}, Normalized, "José Ramírez", "2"},
+		{"Middle name", types.StudentRef{Name: "Jose Luis Ramirez"}, Normalized, "José Ramírez", "2"},
+		{"Nickname", types.StudentRef{Name: "Jonny Smith"}, Nickname, "Jonathan Smith", "K"},
+		{"Typo", types.StudentRef{Name: "Katherine ONiell", Class: "4"}, Fuzzy, "Katherine O'Neil", "4"},
+		{"Typo in another class", types.StudentRef{Name: "Jonathon Smith", Class: "3"}, Unmatched, "", ""},
+		{"Unknown", types.StudentRef{Name: "Nobody Here"}, Unmatched, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := idx.Match(tt.ref)
+			if m.Method != tt.method {
+				t.Fatalf("got method %s, want %s (%+v)", m.Method, tt.method, m)
+			}
+			if m.Student.Name != tt.student || m.Student.Class != tt.class {
+				t.Errorf("got %s (%s), want %s (%s)", m.Student.Name, m.Student.Class, tt.student, tt.class)
+			}
+			if tt.method == Unmatched && (m.Confidence != 0 || m.Reason == "") {
+				t.Errorf("unexpected unmatched result: %+v", m)
+			}
+		})
+	}
+}
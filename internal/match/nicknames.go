@@ -0,0 +1,67 @@
+package match
+
+// nicknameGroups lists first names that are commonly used for one another.
+var nicknameGroups = [][]string{
+	{"abigail", "abby", "abbie", "gail"},
+	{"alexander", "alex", "alejandro", "xander", "sasha"},
+	{"alexandra", "alex", "alexa", "ali", "sasha", "lexi"},
+	{"alberto", "beto", "al"},
+	{"andrew", "andy", "drew"},
+	{"anthony", "tony", "antonio"},
+	{"benjamin", "ben", "benny", "benji"},
+	{"catherine", "katherine", "kathryn", "kate", "katie", "kathy", "cathy", "kat"},
+	{"charles", "charlie", "chuck", "carlos"},
+	{"christopher", "chris", "topher"},
+	{"christina", "christine", "chris", "tina"},
+	{"daniel", "dan", "danny"},
+	{"david", "dave", "davey"},
+	{"eduardo", "lalo", "eddie"},
+	{"edward", "ed", "eddie", "ted", "teddy", "ned"},
+	{"elizabeth", "liz", "lizzy", "beth", "betsy", "eliza", "ellie", "libby"},
+	{"francisco", "paco", "pancho", "frank", "frankie"},
+	{"gabriel", "gabe"},
+	{"gabriela", "gabby", "gaby"},
+	{"guadalupe", "lupe", "lupita"},
+	{"guillermo", "memo", "willy"},
+	{"ignacio", "nacho"},
+	{"isabella", "isabel", "izzy", "bella", "isa"},
+	{"james", "jim", "jimmy", "jamie"},
+	{"jennifer", "jen", "jenny"},
+	{"jesus", "chuy"},
+	{"jonathan", "jon", "jonny", "johnny", "john"},
+	{"jose", "pepe"},
+	{"joseph", "joe", "joey"},
+	{"margaret", "maggie", "meg", "peggy", "greta"},
+	{"matthew", "matt", "matty"},
+	{"maximilian", "maxwell", "max"},
+	{"michael", "mike", "mikey", "mick"},
+	{"nathan", "nathaniel", "nate", "nat"},
+	{"nicholas", "nick", "nicky", "nico"},
+	{"oliver", "olivia", "ollie", "liv"},
+	{"patrick", "patricia", "pat", "patty"},
+	{"richard", "rick", "ricky", "rich", "dick"},
+	{"ricardo", "rick", "ricky"},
+	{"robert", "rob", "robbie", "bob", "bobby", "bert"},
+	{"roberto", "beto", "rob"},
+	{"samuel", "samantha", "sam", "sammy"},
+	{"sophia", "sophie"},
+	{"stephen", "steven", "steve", "stevie"},
+	{"susan", "sue", "suzy", "susie"},
+	{"thomas", "tom", "tommy"},
+	{"timothy", "tim", "timmy"},
+	{"victoria", "vicky", "tori"},
+	{"william", "will", "bill", "billy", "willy", "liam"},
+	{"zachary", "zach", "zack"},
+}
+
+// nicknames holds the nickname groups as sets for quick lookups.
+var nicknames = func() []map[string]bool {
+	groups := make([]map[string]bool, len(nicknameGroups))
+	for i, names := range nicknameGroups {
+		groups[i] = make(map[string]bool)
+		for _, name := range names {
+			groups[i][name] = true
+		}
+	}
+	return groups
+}()
@@ -8,6 +8,9 @@ import (
 
 func DateFromFileName(fn string) string {
 	parts := strings.Split(fn, "-")
+	if len(parts) < 3 {
+		return ""
+	}
 	t, err := time.Parse("2006-01-02", fmt.Sprintf("%s-%s-%s", parts[0], parts[1], parts[2]))
 	if err != nil {
 		return ""
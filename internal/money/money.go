@@ -0,0 +1,237 @@
+// Package money represents donation amounts as an exact number of cents
+// so that splitting and summing amounts never loses a penny.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Cents is an amount of money in US cents.
+type Cents int64
+
+// Dollars returns the amount in dollars, for writing to a spreadsheet
+// cell formatted as currency.
+func (c Cents) Dollars() float64 {
+	return float64(c) / 100
+}
+
+// String formats the amount as a dollar amount, e.g. "$1250.05" or "-$3.00".
+func (c Cents) String() string {
+	sign := ""
+	if c < 0 {
+		sign = "-"
+		c = -c
+	}
+	return fmt.Sprintf("%s$%d.%02d", sign, c/100, c%100)
+}
+
+// Split divides the amount into n shares that add up exactly to the
+// amount.  Cents that can't be divided evenly go one each to the first
+// shares, so the same amount is always split the same way.
+func (c Cents) Split(n int) []Cents {
+	if n <= 0 {
+		return nil
+	}
+
+	shares := make([]Cents, n)
+	quotient := c / Cents(n)
+	remainder := c % Cents(n)
+
+	step := Cents(1)
+	if remainder < 0 {
+		step = -1
+		remainder = -remainder
+	}
+
+	for i := range shares {
+		shares[i] = quotient
+		if Cents(i) < remainder {
+			shares[i] += step
+		}
+	}
+
+	return shares
+}
+
+// Allocate divides the amount into shares proportional to weights that
+// add up exactly to the amount.  Cents left over after rounding down go
+// one each to the first shares with a weight, like Split.  Negative
+// weights count as zero; when every weight is zero nothing is allocated.
+func (c Cents) Allocate(weights []int) []Cents {
+	shares := make([]Cents, len(weights))
+
+	total := 0
+	for _, w := range weights {
+		total += max(w, 0)
+	}
+	if total == 0 {
+		return shares
+	}
+
+	var allocated Cents
+	for i, w := range weights {
+		shares[i] = c * Cents(max(w, 0)) / Cents(total)
+		allocated += shares[i]
+	}
+
+	step := Cents(1)
+	left := c - allocated
+	if left < 0 {
+		step = -1
+	}
+	for i := 0; left != 0; i = (i + 1) % len(weights) {
+		if weights[i] > 0 {
+			shares[i] += step
+			left -= step
+		}
+	}
+
+	return shares
+}
+
+// ErrMissing is returned by Parse for an empty amount.
+var ErrMissing = errors.New("missing amount")
+
+// plainNumber matches an unsigned decimal number, as found in cells that
+// the spreadsheet returns unformatted, including scientific notation.
+var plainNumber = regexp.MustCompile(`^(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// groupedNumber matches a number using commas as thousands separators.
+var groupedNumber = regexp.MustCompile(`^\d{1,3}(,\d{3})+(\.\d*)?$`)
+
+// currencyCode matches a three letter ISO currency code.
+var currencyCode = regexp.MustCompile(`^[A-Za-z]{3}$`)
+
+// Parse converts a dollar amount to cents.  It accepts the formats seen
+// in donation platform exports and spreadsheet cells:
+//
+//	$10.00, 10, 1.25E+03   plain and unformatted amounts
+//	$1,250.00              thousands separators
+//	-$10.00, $-10.00       negative amounts such as refunds
+//	($25.00), $25.00-      accounting style negatives
+//	USD 10.00, 10.00 USD   currency codes
+//
+// Amounts in any currency other than US dollars are rejected rather than
+// being counted as dollars.  Fractions of a cent are rounded half away
+// from zero.
+func Parse(amount string) (Cents, error) {
+	s := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, amount)
+
+	if s == "" {
+		return 0, ErrMissing
+	}
+
+	signs := 0
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		signs++
+		s = s[1 : len(s)-1]
+	}
+
+	// The minus sign may come before or after the currency symbol
+	for _, strip := range []func(string) (string, bool, error){trimSign, trimCurrency, trimSign} {
+		var negative bool
+		var err error
+		s, negative, err = strip(s)
+		if err != nil {
+			return 0, fmt.Errorf("%w in amount %q", err, amount)
+		}
+		if negative {
+			signs++
+		}
+	}
+
+	if signs > 1 {
+		return 0, fmt.Errorf("invalid dollar amount %q", amount)
+	}
+
+	if groupedNumber.MatchString(s) {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+
+	c, err := parseUnsigned(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid dollar amount %q", amount)
+	}
+
+	if signs == 1 {
+		c = -c
+	}
+	return c, nil
+}
+
+// trimSign removes a leading or trailing minus or a leading plus sign and
+// reports whether the amount was negative.
+func trimSign(s string) (string, bool, error) {
+	switch {
+	case strings.HasPrefix(s, "-"):
+		return s[1:], true, nil
+	case strings.HasSuffix(s, "-"):
+		return s[:len(s)-1], true, nil
+	case strings.HasPrefix(s, "+"):
+		return s[1:], false, nil
+	}
+	return s, false, nil
+}
+
+// trimCurrency removes a US dollar symbol or code from either end of the
+// amount and fails on any other currency.  It never reports a sign.
+func trimCurrency(s string) (string, bool, error) {
+	upper := strings.ToUpper(s)
+	for _, prefix := range []string{"US$", "USD", "$"} {
+		if strings.HasPrefix(upper, prefix) {
+			return s[len(prefix):], false, nil
+		}
+	}
+	if strings.HasSuffix(upper, "USD") {
+		return s[:len(s)-3], false, nil
+	}
+
+	for _, symbol := range []string{"€", "£", "¥", "₹", "₩", "₽"} {
+		if strings.HasPrefix(s, symbol) || strings.HasSuffix(s, symbol) {
+			return s, false, fmt.Errorf("unsupported currency %s", symbol)
+		}
+	}
+
+	if len(s) > 3 {
+		for _, code := range []string{s[:3], s[len(s)-3:]} {
+			if currencyCode.MatchString(code) {
+				return s, false, fmt.Errorf("unsupported currency %s", strings.ToUpper(code))
+			}
+		}
+	}
+
+	return s, false, nil
+}
+
+// parseUnsigned parses an unsigned decimal number of dollars exactly,
+// without going through floating point.
+func parseUnsigned(s string) (Cents, error) {
+	if !plainNumber.MatchString(s) {
+		return 0, fmt.Errorf("not a number: %q", s)
+	}
+
+	dollars, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("not a number: %q", s)
+	}
+
+	// Round to whole cents, half away from zero
+	cents := new(big.Rat).Mul(dollars, big.NewRat(100, 1))
+	cents.Add(cents, big.NewRat(1, 2))
+	whole := new(big.Int).Quo(cents.Num(), cents.Denom())
+	if !whole.IsInt64() {
+		return 0, fmt.Errorf("amount out of range: %q", s)
+	}
+
+	return Cents(whole.Int64()), nil
+}
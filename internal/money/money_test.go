@@ -0,0 +1,113 @@
+package money
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount   string
+		expected Cents
+	}{
+		{"$10.00", 1000},
+		{"$ 10.5", 1050},
+		{"0.99", 99},
+		{"-$3.00", -300},
+		{"12", 1200},
+		{"33.335", 3334},
+		{"$1,250.00", 125000},
+		{"1,000,000", 100000000},
+		{"($25.00)", -2500},
+		{"$25.00-", -2500},
+		{"$-10", -1000},
+		{"USD 10.00", 1000},
+		{"10.00 USD", 1000},
+		{"US$5", 500},
+		{"1.25E+03", 125000},
+		{"1250.5", 125050},
+		{".5", 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got, err := Parse(tt.amount)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %d, want %d", got, tt.expected)
+			}
+		})
+	}
+
+	for _, amount := range []string{"", "ten dollars", "€10.00", "10.00 CAD", "-($5.00)", "1,25.00", "1/3"} {
+		if _, err := Parse(amount); err == nil {
+			t.Errorf("%q: expected an error", amount)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   Cents
+		n        int
+		expected []Cents
+	}{
+		{"Even split", 1000, 2, []Cents{500, 500}},
+		{"Hundred dollars three ways", 10000, 3, []Cents{3334, 3333, 3333}},
+		{"Two cents three ways", 2, 3, []Cents{1, 1, 0}},
+		{"Refund three ways", -10000, 3, []Cents{-3334, -3333, -3333}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.amount.Split(tt.n)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+
+			var sum Cents
+			for _, share := range got {
+				sum += share
+			}
+			if sum != tt.amount {
+				t.Errorf("shares add up to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   Cents
+		weights  []int
+		expected []Cents
+	}{
+		{"Equal weights", 10000, []int{1, 1, 1}, []Cents{3334, 3333, 3333}},
+		{"Two to one", 10000, []int{2, 1}, []Cents{6667, 3333}},
+		{"Zero weight", 1001, []int{0, 1, 1}, []Cents{0, 501, 500}},
+		{"Refund", -10000, []int{2, 1}, []Cents{-6667, -3333}},
+		{"No weights", 10000, []int{0, 0}, []Cents{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.amount.Allocate(tt.weights)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	if got := Cents(125005).String(); got != "$1250.05" {
+		t.Errorf("got %q", got)
+	}
+	if got := Cents(-300).String(); got != "-$3.00" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,99 @@
+// Package override applies the office's manual name corrections to the
+// donation transactions before they are assigned to students, and keeps
+// a record of every correction so the report shows what was changed.
+package override
+
+import (
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// Applied records a correction made to a transaction.
+type Applied struct {
+	Txn   *types.DonationTransaction
+	Alias types.Alias
+	// Before and After describe the corrected value
+	Before string
+	After  string
+}
+
+// Apply corrects the transactions in place.  Donor aliases rename the
+// donor; account aliases rename the donor of the account and, when the
+// transaction doesn't name any student, give it the students of the
+// account; student aliases replace a student named on the transaction
+// with the roster student meant.
+func Apply(aliases []types.Alias, donations []*types.DonationTransaction) []Applied {
+	var applied []Applied
+
+	for _, txn := range donations {
+		for _, alias := range aliases {
+			if alias.Kind != types.DonorAlias || !same(alias.From, txn.Name) || txn.Name == alias.DonorName {
+				continue
+			}
+			applied = append(applied, Applied{Txn: txn, Alias: alias, Before: txn.Name, After: alias.DonorName})
+			txn.Name = alias.DonorName
+		}
+
+		// An account can hold several siblings, one alias each
+		var accountStudents []types.StudentRef
+		var accountAliases []types.Alias
+		named := len(txn.StudentNames()) > 0
+		for _, alias := range aliases {
+			if alias.Kind != types.AccountAlias || txn.AccountNumber == "" || !same(alias.From, txn.AccountNumber) {
+				continue
+			}
+			if alias.DonorName != "" && txn.Name != alias.DonorName {
+				applied = append(applied, Applied{Txn: txn, Alias: alias, Before: txn.Name, After: alias.DonorName})
+				txn.Name = alias.DonorName
+			}
+			if !named && (alias.Student.Name != "" || alias.Student.ID != "") {
+				accountStudents = append(accountStudents, alias.Student)
+				accountAliases = append(accountAliases, alias)
+			}
+		}
+		for i, ref := range accountStudents {
+			applied = append(applied, Applied{Txn: txn, Alias: accountAliases[i], After: describe(ref)})
+		}
+		txn.Students = append(txn.Students, accountStudents...)
+
+		for i, ref := range txn.Students {
+			for _, alias := range aliases {
+				if alias.Kind != types.StudentAlias || !same(alias.From, ref.Name) {
+					continue
+				}
+				if alias.FromClass != "" && !same(alias.FromClass, ref.Class) {
+					continue
+				}
+				// Only the name is corrected; the donor's amount for the
+				// student stays with them
+				corrected := alias.Student
+				corrected.Amount = ref.Amount
+				if corrected.Class == "" {
+					corrected.Class = ref.Class
+				}
+				applied = append(applied, Applied{Txn: txn, Alias: alias, Before: describe(ref), After: describe(corrected)})
+				txn.Students[i] = corrected
+				break
+			}
+		}
+	}
+
+	return applied
+}
+
+// describe returns the student as shown in the report, with their class.
+func describe(ref types.StudentRef) string {
+	name := ref.Name
+	if name == "" {
+		name = ref.ID
+	}
+	if ref.Class == "" {
+		return name
+	}
+	return name + " (" + ref.Class + ")"
+}
+
+func same(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
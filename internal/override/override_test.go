@@ -0,0 +1,63 @@
+package override
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+func TestApply(t *testing.T) {
+	aliases := []types.Alias{
+		{Kind: types.DonorAlias, From: "jhon  doe", DonorName: "John Doe"},
+		{Kind: types.AccountAlias, From: "A1", Student: types.StudentRef{Name: "Sam Lee", Class: "2"}},
+		{Kind: types.AccountAlias, From: "A1", Student: types.StudentRef{Name: "Ana Lee", Class: "4"}},
+		{Kind: types.AccountAlias, From: "A2", DonorName: "Grandma Roe"},
+		{Kind: types.StudentAlias, From: "Jonny Smith", FromClass: "K", Student: types.StudentRef{Name: "Jonathan Smith"}},
+	}
+
+	donations := []*types.DonationTransaction{
+		{Name: "Jhon Doe", Amount: 1000, Students: []types.StudentRef{{Name: "Jonny Smith", Class: "K"}}},
+		{Name: "Jane Lee", Amount: 2000, AccountNumber: "A1"},
+		{Name: "Jane Lee", Amount: 500, AccountNumber: "A1", Students: []types.StudentRef{{Name: "Sam Lee", Class: "2"}}},
+		{Name: "G. Roe", Amount: 700, AccountNumber: "A2", Students: []types.StudentRef{{Name: "Jonny Smith", Class: "3"}}},
+	}
+
+	applied := Apply(aliases, donations)
+
+	if donations[0].Name != "John Doe" || donations[0].Students[0] != (types.StudentRef{Name: "Jonathan Smith", Class: "K"}) {
+		t.Errorf("unexpected transaction: %+v", donations[0])
+	}
+	if names := donations[1].StudentNames(); len(names) != 2 || names[1] != "Ana Lee" {
+		t.Errorf("account students not added: %+v", donations[1])
+	}
+	if len(donations[2].Students) != 1 {
+		t.Errorf("account students added to a transaction that names a student: %+v", donations[2])
+	}
+	if donations[3].Name != "Grandma Roe" || donations[3].Students[0].Name != "Jonny Smith" {
+		t.Errorf("unexpected transaction: %+v", donations[3])
+	}
+
+	if len(applied) != 5 {
+		t.Fatalf("got %d corrections, want 5: %+v", len(applied), applied)
+	}
+	if a := applied[1]; a.Before != "Jonny Smith (K)" || a.After != "Jonathan Smith (K)" {
+		t.Errorf("unexpected correction: %+v", a)
+	}
+}
+
+func TestApplyKeepsStudentAmounts(t *testing.T) {
+	aliases := []types.Alias{
+		{Kind: types.StudentAlias, From: "Jonny Smith", Student: types.StudentRef{Name: "Jonathan Smith"}},
+	}
+	donations := []*types.DonationTransaction{
+		{Name: "Jane Smith", Amount: 10000, Students: []types.StudentRef{{Name: "Jonny Smith", Amount: 7000}, {Name: "Ana Smith", Amount: 3000}}},
+	}
+
+	Apply(aliases, donations)
+
+	want := []types.StudentRef{{Name: "Jonathan Smith", Amount: 7000}, {Name: "Ana Smith", Amount: 3000}}
+	if got := donations[0].Students; !reflect.DeepEqual(got, want) {
+		t.Errorf("got students %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/jotacamou/datacor/internal/campaign"
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/types"
+	excelize "github.com/xuri/excelize/v2"
+)
+
+// campaignAmount returns what the student was given for the named
+// campaign.  Gifts without a campaign are under campaign.Untagged.
+func campaignAmount(student types.Student, name string) money.Cents {
+	var amount money.Cents
+	for tagged, cents := range student.Campaigns {
+		if tagged == "" {
+			tagged = campaign.Untagged
+		}
+		if campaign.Key(tagged) == campaign.Key(name) {
+			amount += cents
+		}
+	}
+	return amount
+}
+
+// writeCampaigns writes what each student was given for each campaign to
+// a new sheet of the report, one column per campaign, with the totals of
+// the school last.
+func writeCampaigns(f *excelize.File, sheetName string, campaigns []string, students types.AllStudents, dollarAmountStyle int) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Student",
+		"Class",
+	}
+	for _, name := range campaigns {
+		header = append(header, name)
+	}
+	header = append(header, "Total Donation Amount")
+
+	if err := f.SetSheetRow(sheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	lastCol, err := excelize.ColumnNumberToName(len(header))
+	if err != nil {
+		return err
+	}
+	if err := f.SetColStyle(sheetName, "C:"+lastCol, dollarAmountStyle); err != nil {
+		return err
+	}
+
+	totals := make([]money.Cents, len(campaigns)+1)
+
+	rowIndex := 2
+	for _, student := range sortedStudents(students) {
+		row := []interface{}{
+			student.Name,
+			student.Class,
+		}
+		for i, name := range campaigns {
+			amount := campaignAmount(student, name)
+			totals[i] += amount
+			row = append(row, amount.Dollars())
+		}
+		totals[len(campaigns)] += student.TotalDonationAmount
+		row = append(row, student.TotalDonationAmount.Dollars())
+
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", rowIndex), &row); err != nil {
+			return err
+		}
+		rowIndex++
+	}
+
+	row := []interface{}{"Whole School", ""}
+	for _, total := range totals {
+		row = append(row, total.Dollars())
+	}
+	if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", rowIndex), &row); err != nil {
+		return err
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
@@ -0,0 +1,177 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/types"
+	excelize "github.com/xuri/excelize/v2"
+)
+
+// Kinds of changes since the last report
+const (
+	newDonation   = "New Donation"
+	newDonor      = "New Donor"
+	totalChanged  = "Total Changed"
+	startedGiving = "Started Giving"
+)
+
+// change is a row of the changes since the last report: a donation or
+// donor that is new, or a student whose total is different.
+type change struct {
+	Kind     string
+	Date     string
+	Name     string
+	Class    string
+	Previous money.Cents
+	Current  money.Cents
+}
+
+// compareReports lists what changed between the previous report and
+// this one.  Exports overlap, so a donation is only new when it isn't on
+// the previous export as well; a donor is new when they gave nothing on
+// the previous export.  Students are compared by their totals.
+func compareReports(prevDonations, donations []*types.DonationTransaction, prevStudents, students types.AllStudents) []change {
+	var changes []change
+
+	seen := make(map[string]int)
+	prevDonors := make(map[string]bool)
+	for _, txn := range prevDonations {
+		seen[donationKey(txn)]++
+		prevDonors[donorKey(txn)] = true
+	}
+
+	given := make(map[string]money.Cents)
+	var donors []*types.DonationTransaction
+	for _, txn := range donations {
+		if key := donationKey(txn); seen[key] > 0 {
+			seen[key]--
+		} else {
+			changes = append(changes, change{Kind: newDonation, Date: txn.Date, Name: txn.Name, Current: txn.Amount})
+		}
+
+		key := donorKey(txn)
+		if prevDonors[key] {
+			continue
+		}
+		if _, ok := given[key]; !ok {
+			donors = append(donors, txn)
+		}
+		given[key] += txn.Amount
+	}
+
+	for _, txn := range donors {
+		if amount := given[donorKey(txn)]; amount > 0 {
+			changes = append(changes, change{Kind: newDonor, Date: txn.Date, Name: txn.Name, Current: amount})
+		}
+	}
+
+	for _, student := range sortedStudents(students) {
+		previous := prevStudents[student.Key()].TotalDonationAmount
+		if previous == student.TotalDonationAmount {
+			continue
+		}
+		kind := totalChanged
+		if previous == 0 && student.TotalDonationAmount > 0 {
+			kind = startedGiving
+		}
+		changes = append(changes, change{
+			Kind:     kind,
+			Name:     student.Name,
+			Class:    student.Class,
+			Previous: previous,
+			Current:  student.TotalDonationAmount,
+		})
+	}
+
+	return changes
+}
+
+// donationKey identifies a donation across exports.
+func donationKey(txn *types.DonationTransaction) string {
+	return strings.Join([]string{
+		txn.Date,
+		donorKey(txn),
+		fmt.Sprint(int64(txn.Amount)),
+	}, "|")
+}
+
+// donorKey identifies a donor by account, or by name when the account
+// isn't known.
+func donorKey(txn *types.DonationTransaction) string {
+	if account := strings.TrimSpace(txn.AccountNumber); account != "" {
+		return "account:" + strings.ToLower(account)
+	}
+	return "name:" + strings.ToLower(strings.Join(strings.Fields(txn.Name), " "))
+}
+
+// sortedStudents returns the students ordered by class and name.
+func sortedStudents(students types.AllStudents) []types.Student {
+	sorted := make([]types.Student, 0, len(students))
+	for _, student := range students {
+		sorted = append(sorted, student)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Class != b.Class {
+			return a.Class < b.Class
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Key() < b.Key()
+	})
+	return sorted
+}
+
+// writeChanges writes the changes since the report of previousDate to a
+// new sheet of the report.
+func writeChanges(f *excelize.File, sheetName, previousDate string, changes []change, dollarAmountStyle int) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	if err := f.SetCellValue(sheetName, "A1", "Since:"); err != nil {
+		return err
+	}
+	if err := f.SetCellValue(sheetName, "B1", previousDate); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Change",
+		"Date",
+		"Name",
+		"Class",
+		"Previous Amount",
+		"Current Amount",
+		"Difference",
+	}
+
+	if err := f.SetSheetRow(sheetName, "A2", &header); err != nil {
+		return err
+	}
+
+	if err := f.SetColStyle(sheetName, "E:G", dollarAmountStyle); err != nil {
+		return err
+	}
+
+	for i, c := range changes {
+		row := []interface{}{
+			c.Kind,
+			c.Date,
+			c.Name,
+			c.Class,
+			c.Previous.Dollars(),
+			c.Current.Dollars(),
+			(c.Current - c.Previous).Dollars(),
+		}
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i+3), &row); err != nil {
+			return err
+		}
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jotacamou/datacor/internal/blob"
+)
+
+// Error is returned by Generate when no report could be written.
+type Error struct {
+	// Stage is the step of the run that failed, e.g. "read roster"
+	Stage string
+	File  string
+	Err   error
+	// Retryable errors, such as a storage outage, may go away when the
+	// run is tried again.  Other errors need someone to fix the inputs.
+	Retryable bool
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Stage, e.File, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether err is worth retrying.  Errors that don't
+// come from Generate are assumed not to be.
+func IsRetryable(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Retryable
+}
+
+// fail wraps err as an Error of the given stage.  Errors reading or
+// writing the store are retryable, unless the file doesn't exist;
+// anything wrong with the files themselves is not.
+func fail(stage, file string, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	var storeErr *storeError
+	retryable := errors.As(err, &storeErr) && !errors.Is(err, blob.ErrNotExist)
+	retryable = retryable || errors.Is(err, context.DeadlineExceeded)
+
+	return &Error{Stage: stage, File: file, Err: err, Retryable: retryable}
+}
+
+// storeError marks an error returned by the store.
+type storeError struct {
+	err error
+}
+
+func (e *storeError) Error() string { return e.err.Error() }
+
+func (e *storeError) Unwrap() error { return e.err }
@@ -0,0 +1,197 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/campaign"
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/types"
+	excelize "github.com/xuri/excelize/v2"
+)
+
+// Progress to a goal is shown red below goalBehind of the goal, amber
+// until the goal is met, and green once it is.
+const goalBehind = 0.5
+
+// progress is how much of a goal has been raised.
+type progress struct {
+	// Campaign is the campaign of the goal, if it was set for one
+	Campaign string
+	Level    string // School, Grade or Class
+	Name     string
+	Goal     money.Cents
+	Raised   money.Cents
+}
+
+// Complete is the share of the goal raised.
+func (p progress) Complete() float64 {
+	if p.Goal == 0 {
+		return 0
+	}
+	return float64(p.Raised) / float64(p.Goal)
+}
+
+// Remaining is what is left to raise, nothing once the goal is met.
+func (p progress) Remaining() money.Cents {
+	return max(p.Goal-p.Raised, 0)
+}
+
+// goalProgress compares the goals of the campaign with what was raised:
+// the school goal first, then the grade goals and the class goals in the
+// order they were set.  Goals without a campaign apply to every
+// campaign.  Goals of one of the campaigns the gifts were tagged with
+// are compared with what was raised for that campaign, and goals of the
+// profile's campaign with everything raised when no gift was tagged with
+// it.  A goal for a class or grade with no students on the roster is
+// returned as a row error instead.
+func goalProgress(goals []types.Goal, profile string, campaigns []string, school groupSummary, byGrade, byClass []groupSummary) ([]progress, []schema.RowError) {
+	tagged := make(map[string]bool)
+	for _, name := range campaigns {
+		tagged[campaign.Key(name)] = true
+	}
+
+	var schoolGoals, gradeGoals, classGoals []progress
+	var problems []schema.RowError
+	for _, goal := range goals {
+		raised := func(g groupSummary) money.Cents { return g.Total }
+		switch key := campaign.Key(goal.Campaign); {
+		case goal.Campaign == "":
+			// Everything raised counts towards the goal
+		case tagged[key]:
+			raised = func(g groupSummary) money.Cents { return g.Campaigns[key] }
+		case key == campaign.Key(profile):
+			// No gift was tagged with the campaign of the profile, so
+			// everything raised was for it
+		default:
+			continue
+		}
+
+		find := func(summaries []groupSummary, group string) (money.Cents, bool) {
+			for _, g := range summaries {
+				if normalize(g.Group) == normalize(group) {
+					return raised(g), true
+				}
+			}
+			return 0, false
+		}
+
+		p := progress{Campaign: goal.Campaign, Goal: goal.Amount}
+		switch {
+		case goal.Class != "" || goal.Grade != "":
+			level, name, summaries := "Class", goal.Class, byClass
+			if goal.Class == "" {
+				level, name, summaries = "Grade", goal.Grade, byGrade
+			}
+
+			amount, ok := find(summaries, name)
+			if !ok {
+				problems = append(problems, schema.RowError{
+					Sheet:  "Data",
+					Row:    goal.Row,
+					Column: level,
+					Reason: fmt.Sprintf("no student on the roster is in %s %s, goal not shown", strings.ToLower(level), name),
+				})
+				continue
+			}
+
+			p.Level, p.Name, p.Raised = level, name, amount
+			if level == "Class" {
+				classGoals = append(classGoals, p)
+			} else {
+				gradeGoals = append(gradeGoals, p)
+			}
+		default:
+			p.Level, p.Name, p.Raised = "School", "Whole School", raised(school)
+			schoolGoals = append(schoolGoals, p)
+		}
+	}
+
+	return append(append(schoolGoals, gradeGoals...), classGoals...), problems
+}
+
+// writeGoals writes the progress to each goal to a new sheet of the
+// report, colored red, amber or green by how close it is.
+func writeGoals(f *excelize.File, sheetName string, goals []progress, dollarAmountStyle, percentStyle int) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Campaign",
+		"Level",
+		"Name",
+		"Goal",
+		"Raised",
+		"Percent Complete",
+		"Remaining",
+	}
+
+	if err := f.SetSheetRow(sheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	for _, col := range []string{"D", "E", "G"} {
+		if err := f.SetColStyle(sheetName, col, dollarAmountStyle); err != nil {
+			return err
+		}
+	}
+	if err := f.SetColStyle(sheetName, "F", percentStyle); err != nil {
+		return err
+	}
+
+	for i, p := range goals {
+		row := []interface{}{
+			p.Campaign,
+			p.Level,
+			p.Name,
+			p.Goal.Dollars(),
+			p.Raised.Dollars(),
+			p.Complete(),
+			p.Remaining().Dollars(),
+		}
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+
+	if len(goals) > 0 {
+		if err := colorProgress(f, sheetName, fmt.Sprintf("F2:F%d", len(goals)+1)); err != nil {
+			return err
+		}
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
+
+// colorProgress colors the percent complete cells of rangeRef red, amber
+// or green.
+func colorProgress(f *excelize.File, sheetName, rangeRef string) error {
+	fill := func(color string) (int, error) {
+		return f.NewConditionalStyle(&excelize.Style{
+			Fill: excelize.Fill{Type: "pattern", Color: []string{color}, Pattern: 1},
+		})
+	}
+
+	red, err := fill("#F4CCCC")
+	if err != nil {
+		return err
+	}
+	amber, err := fill("#FFE599")
+	if err != nil {
+		return err
+	}
+	green, err := fill("#B6D7A8")
+	if err != nil {
+		return err
+	}
+
+	behind := strconv.FormatFloat(goalBehind, 'f', -1, 64)
+	return f.SetConditionalFormat(sheetName, rangeRef, []excelize.ConditionalFormatOptions{
+		{Type: "cell", Criteria: ">=", Format: &green, Value: "1", StopIfTrue: true},
+		{Type: "cell", Criteria: ">=", Format: &amber, Value: behind, StopIfTrue: true},
+		{Type: "cell", Criteria: "<", Format: &red, Value: behind},
+	})
+}
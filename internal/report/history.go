@@ -0,0 +1,52 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/blob"
+	"github.com/jotacamou/datacor/internal/history"
+)
+
+// UpdateHistory adds the donations of the upload to the donation history
+// in the store and returns the history.  Without an upload the history
+// is only read.
+func UpdateHistory(ctx context.Context, store blob.Store, upload string, now time.Time) ([]history.Record, error) {
+	records, err := history.Load(ctx, store)
+	if err != nil {
+		return nil, &Error{Stage: "read history", File: history.File, Err: err, Retryable: true}
+	}
+	if upload == "" {
+		return records, nil
+	}
+
+	donations, err := ReadTransactions(ctx, store, upload)
+	if err != nil {
+		return nil, err
+	}
+
+	records, added := history.Upsert(records, upload, donations, now)
+	if err := history.Save(ctx, store, records); err != nil {
+		return nil, &Error{Stage: "write history", File: history.File, Err: err, Retryable: true}
+	}
+
+	fmt.Printf("%d new donations added to %s\n", added, history.File)
+
+	return records, nil
+}
+
+// HistoryEnd returns the last day of the donation history a report
+// covers: to when it's given, else the date of the upload, else now.
+// Donations dated after the export are only counted once an export
+// includes them.
+func HistoryEnd(to, uploaded, now time.Time) time.Time {
+	switch {
+	case !to.IsZero():
+		return to
+	case !uploaded.IsZero():
+		return uploaded
+	default:
+		return now
+	}
+}
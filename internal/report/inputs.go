@@ -0,0 +1,160 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jotacamou/datacor/internal/blob"
+	"github.com/jotacamou/datacor/internal/ingest"
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/tabular"
+	"github.com/jotacamou/datacor/internal/types"
+)
+
+// readStudents builds the list of every student of the roster along
+// with their care givers.
+func readStudents(ctx context.Context, store blob.Store, roster string) (types.AllStudents, []schema.RowError, error) {
+	parents, problems, err := readParents(ctx, store, roster)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	students := make(types.AllStudents)
+
+	// Students are keyed by their roster ID, or by name and class, so
+	// that two students with the same name are kept apart while a child
+	// listed under each of their parents is only counted once
+	for _, parent := range parents {
+		for _, child := range parent.Children {
+			key := child.Key()
+			if existingChild, ok := students[key]; ok {
+				addParent(&existingChild, parent.Name)
+				addAccount(&existingChild, parent.AccountNumber)
+				students[key] = existingChild
+			} else {
+				addParent(&child, parent.Name)
+				addAccount(&child, parent.AccountNumber)
+				students[key] = child
+			}
+		}
+	}
+
+	return students, problems, nil
+}
+
+// addParent adds a care giver to the student.  A student can have any
+// number of care givers.
+func addParent(student *types.Student, parentName string) {
+	student.Parents = append(student.Parents, parentName)
+}
+
+// addAccount links the student to a family account so that gifts from
+// that account can be attributed to them.  Each account is kept once.
+func addAccount(student *types.Student, account string) {
+	if account == "" || slices.Contains(student.Accounts, account) {
+		return
+	}
+	student.Accounts = append(student.Accounts, account)
+}
+
+// readParents reads the parent-child data from the roster spreadsheet.
+// Rows that can't be used as-is are returned as problems so they can
+// be reported back to the office instead of stopping the run.
+func readParents(ctx context.Context, store blob.Store, roster string) ([]*types.Parent, []schema.RowError, error) {
+	rows, err := readSheet(ctx, store, roster, "Data")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ingest.ParseRoster("Data", rows)
+}
+
+// readTransactions reads the donation transactions from the "Data"
+// sheet of the transactions file.  Columns are located by their header
+// names and a missing required column fails the whole run.  Rows that
+// can't be used are returned as problems.
+func readTransactions(ctx context.Context, store blob.Store, transactions string) ([]*types.DonationTransaction, []schema.RowError, error) {
+	rows, err := readSheet(ctx, store, transactions, "Data")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ingest.ParseTransactions("Data", rows)
+}
+
+// readAliases reads the office's name corrections from the "Data" sheet
+// of the aliases file.  The file is optional; without it no corrections
+// are made.
+func readAliases(ctx context.Context, store blob.Store, aliases string) ([]types.Alias, []schema.RowError, error) {
+	rows, err := readSheet(ctx, store, aliases, "Data")
+	if errors.Is(err, blob.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ingest.ParseAliases("Data", rows)
+}
+
+// readExclusions reads the families and students left out of the
+// participation rates from the "Data" sheet of the exclusions file.  The
+// file is optional; without it everyone is counted.
+func readExclusions(ctx context.Context, store blob.Store, exclusions string) ([]types.Exclusion, []schema.RowError, error) {
+	rows, err := readSheet(ctx, store, exclusions, "Data")
+	if errors.Is(err, blob.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ingest.ParseExclusions("Data", rows)
+}
+
+// readGoals reads the fundraising goals from the "Data" sheet of the
+// goals file.  The file is optional; without it no progress is shown.
+func readGoals(ctx context.Context, store blob.Store, goals string) ([]types.Goal, []schema.RowError, error) {
+	rows, err := readSheet(ctx, store, goals, "Data")
+	if errors.Is(err, blob.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ingest.ParseGoals("Data", rows)
+}
+
+// readCampaignRules reads the rules tagging gifts with their campaign
+// from the "Data" sheet of the campaigns file.  The file is optional;
+// without it gifts only have the campaign given in the export.
+func readCampaignRules(ctx context.Context, store blob.Store, campaigns string) ([]types.CampaignRule, []schema.RowError, error) {
+	rows, err := readSheet(ctx, store, campaigns, "Data")
+	if errors.Is(err, blob.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ingest.ParseCampaignRules("Data", rows)
+}
+
+// readSheet reads every row of a sheet of an Excel workbook, or of a CSV
+// or TSV file, in the store.
+func readSheet(ctx context.Context, store blob.Store, fileName, sheet string) ([][]string, error) {
+	data, err := store.Read(ctx, fileName)
+	if err != nil {
+		return nil, &storeError{err}
+	}
+
+	rows, err := tabular.Rows(data, sheet)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,128 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/types"
+	excelize "github.com/xuri/excelize/v2"
+)
+
+// participating reports whether anyone, care giver or not, has given for
+// the student.
+func participating(student types.Student) bool {
+	return student.TotalDonationAmount > 0
+}
+
+// applyExclusions marks the students each exclusion names: every student
+// of an excluded account or care giver, or the excluded student itself.
+// Exclusions that name no student on the roster are returned so they
+// can be reported.
+func applyExclusions(students types.AllStudents, exclusions []types.Exclusion) []types.Exclusion {
+	var unmatched []types.Exclusion
+
+	for _, exclusion := range exclusions {
+		matched := false
+		for key, student := range students {
+			if !excludes(exclusion, student) {
+				continue
+			}
+			student.Excluded = true
+			students[key] = student
+			matched = true
+		}
+		if !matched {
+			unmatched = append(unmatched, exclusion)
+		}
+	}
+
+	return unmatched
+}
+
+// excludes reports whether the exclusion names the student or its family.
+func excludes(exclusion types.Exclusion, student types.Student) bool {
+	if exclusion.Account != "" {
+		for _, account := range student.Accounts {
+			if normalize(account) == normalize(exclusion.Account) {
+				return true
+			}
+		}
+	}
+	if exclusion.CareGiver != "" {
+		for _, parent := range student.Parents {
+			if normalize(parent) == normalize(exclusion.CareGiver) {
+				return true
+			}
+		}
+	}
+	ref := exclusion.Student
+	switch {
+	case ref.ID != "":
+		return ref.ID == student.ID
+	case ref.Name != "":
+		return normalize(ref.Name) == normalize(student.Name) &&
+			(ref.Class == "" || normalize(ref.Class) == normalize(student.Class))
+	}
+	return false
+}
+
+// participatingFamilies returns the families, by familyKey, that have
+// given for any of their students who aren't excluded.
+func participatingFamilies(students types.AllStudents) map[string]bool {
+	families := make(map[string]bool)
+	for _, student := range students {
+		if !student.Excluded && participating(student) {
+			families[familyKey(student)] = true
+		}
+	}
+	return families
+}
+
+// writeNotParticipating lists the students no one has given for yet, by
+// class, for outreach.  Excluded students aren't listed.
+func writeNotParticipating(f *excelize.File, sheetName string, students types.AllStudents) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Class",
+		"Student",
+		"Care Givers",
+		"Account Numbers",
+		"Family Participating",
+	}
+
+	if err := f.SetSheetRow(sheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	families := participatingFamilies(students)
+
+	rowIndex := 2
+	for _, student := range sortedStudents(students) {
+		if student.Excluded || participating(student) {
+			continue
+		}
+
+		// A sibling may have been given for already
+		family := "No"
+		if families[familyKey(student)] {
+			family = "Yes"
+		}
+
+		row := []interface{}{
+			student.Class,
+			student.Name,
+			strings.Join(student.Parents, "; "),
+			strings.Join(student.Accounts, "; "),
+			family,
+		}
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", rowIndex), &row); err != nil {
+			return err
+		}
+		rowIndex++
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
@@ -0,0 +1,541 @@
+// Package report builds the donations by student workbook from the
+// roster and a transactions export.  The Cloud Function and the CLI both
+// generate their report here, reading and writing files through a
+// blob.Store, so that they always produce the same workbook.
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/jotacamou/datacor/internal/alloc"
+	"github.com/jotacamou/datacor/internal/blob"
+	"github.com/jotacamou/datacor/internal/campaign"
+	"github.com/jotacamou/datacor/internal/ingest"
+	"github.com/jotacamou/datacor/internal/override"
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/types"
+	excelize "github.com/xuri/excelize/v2"
+)
+
+// Names of the files read from the store when Inputs doesn't name them
+const (
+	// RosterFile is the master parents and kids file.  If this file
+	// doesn't exist then there is nothing to report on.
+	RosterFile = "parents-kids-classes.xlsx"
+	// AliasesFile holds the office's standing name corrections.  It is
+	// optional.
+	AliasesFile = "name-corrections.xlsx"
+	// ExclusionsFile lists the families and students left out of the
+	// participation rates, such as scholarship families.  It is optional.
+	ExclusionsFile = "participation-exclusions.xlsx"
+	// GoalsFile holds the fundraising goals of each campaign.  It is
+	// optional.
+	GoalsFile = "goals.xlsx"
+	// CampaignsFile holds the rules tagging gifts with the campaign they
+	// were given to.  It is optional.
+	CampaignsFile = "campaigns.xlsx"
+)
+
+// Inputs names the files a report is generated from.
+type Inputs struct {
+	Store blob.Store
+	// Transactions is the transactions export from the donation platform
+	Transactions string
+	// Roster defaults to RosterFile
+	Roster string
+	// Aliases defaults to AliasesFile
+	Aliases string
+	// Exclusions defaults to ExclusionsFile
+	Exclusions string
+	// Goals defaults to GoalsFile
+	Goals string
+	// Campaigns defaults to CampaignsFile
+	Campaigns string
+	// Donations, when set, are reported on instead of reading
+	// Transactions, such as a period of the donation history
+	Donations []*types.DonationTransaction
+	// Previous is the transactions export of the last report, if any.
+	// The report then lists what changed since.
+	Previous string
+}
+
+// Options controls how the report is generated.
+type Options struct {
+	// Output is the name the workbook is written to in the store
+	Output string
+	// ReportDate is shown at the top of the report as the date it was
+	// last updated
+	ReportDate string
+	// PreviousDate is the date of the previous transactions export
+	PreviousDate string
+	// Policy shares gifts for several siblings.  Gifts are split evenly
+	// when it is nil.
+	Policy alloc.Policy
+	// Campaign picks the goals the report shows progress to, along with
+	// the goals set for every campaign
+	Campaign string
+}
+
+// Generate builds the donations by student report and writes it to the
+// input store as opts.Output.  Row problems in the inputs don't stop the
+// report; they are listed on their own sheets.  Any other failure is
+// returned as an *Error.
+func Generate(ctx context.Context, in Inputs, opts Options) error {
+	if in.Roster == "" {
+		in.Roster = RosterFile
+	}
+	if in.Aliases == "" {
+		in.Aliases = AliasesFile
+	}
+	if in.Exclusions == "" {
+		in.Exclusions = ExclusionsFile
+	}
+	if in.Goals == "" {
+		in.Goals = GoalsFile
+	}
+	if in.Campaigns == "" {
+		in.Campaigns = CampaignsFile
+	}
+	if opts.Policy == nil {
+		opts.Policy = alloc.EvenSplit{}
+	}
+
+	f := excelize.NewFile()
+	defer func() {
+		if err := f.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	if err := build(ctx, f, in, opts); err != nil {
+		return fail("build report", opts.Output, err)
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		return fail("build report", opts.Output, err)
+	}
+
+	if err := in.Store.Write(ctx, opts.Output, buf.Bytes()); err != nil {
+		return fail("write report", opts.Output, &storeError{err})
+	}
+
+	return nil
+}
+
+// ReadTransactions reads the donations of a transactions export as they
+// were exported, before any name correction.
+func ReadTransactions(ctx context.Context, store blob.Store, transactions string) ([]*types.DonationTransaction, error) {
+	donations, _, err := readTransactions(ctx, store, transactions)
+	if err != nil {
+		return nil, fail("read transactions", transactions, err)
+	}
+	return donations, nil
+}
+
+// build writes every sheet of the report to f.
+func build(ctx context.Context, f *excelize.File, in Inputs, opts Options) error {
+	sheetName := "Donations By Student"
+	i, err := f.NewSheet(sheetName)
+	if err != nil {
+		return err
+	}
+
+	f.SetActiveSheet(i)
+
+	err = f.DeleteSheet("Sheet1")
+	if err != nil {
+		return err
+	}
+
+	students, rosterProblems, err := readStudents(ctx, in.Store, in.Roster)
+	if err != nil {
+		return fail("read roster", in.Roster, err)
+	}
+
+	for _, problem := range rosterProblems {
+		fmt.Println(problem)
+	}
+
+	// Donations taken from the history are used as they are
+	donations, txnProblems := in.Donations, []schema.RowError(nil)
+	if donations == nil {
+		donations, txnProblems, err = readTransactions(ctx, in.Store, in.Transactions)
+		if err != nil {
+			return fail("read transactions", in.Transactions, err)
+		}
+	}
+
+	for _, problem := range txnProblems {
+		fmt.Println(problem)
+	}
+
+	// The office's standing name corrections are applied before any
+	// money is assigned so that the same misspellings are fixed every run
+	aliases, aliasProblems, err := readAliases(ctx, in.Store, in.Aliases)
+	if err != nil {
+		return fail("read name corrections", in.Aliases, err)
+	}
+
+	for _, problem := range aliasProblems {
+		fmt.Println(problem)
+	}
+
+	corrections := override.Apply(aliases, donations)
+
+	// Gifts the export doesn't give a campaign are tagged by the rules
+	rules, ruleProblems, err := readCampaignRules(ctx, in.Store, in.Campaigns)
+	if err != nil {
+		return fail("read campaign rules", in.Campaigns, err)
+	}
+
+	for _, problem := range ruleProblems {
+		fmt.Println(problem)
+	}
+
+	campaign.Tag(rules, donations)
+	campaigns := campaign.Names(donations)
+
+	// Families left out of the participation rates, e.g. on scholarship
+	exclusions, exclusionProblems, err := readExclusions(ctx, in.Store, in.Exclusions)
+	if err != nil {
+		return fail("read participation exclusions", in.Exclusions, err)
+	}
+
+	for _, problem := range exclusionProblems {
+		fmt.Println(problem)
+	}
+
+	for _, exclusion := range applyExclusions(students, exclusions) {
+		fmt.Printf("Participation exclusion on row %d names no student on the roster\n", exclusion.Row)
+	}
+
+	goals, goalProblems, err := readGoals(ctx, in.Store, in.Goals)
+	if err != nil {
+		return fail("read goals", in.Goals, err)
+	}
+
+	for _, problem := range goalProblems {
+		fmt.Println(problem)
+	}
+
+	// The previous export is assigned the same way against this roster
+	// so that only changes in giving show up, not roster edits
+	var prevStudents types.AllStudents
+	var prevDonations []*types.DonationTransaction
+	if in.Previous != "" {
+		prevDonations, _, err = readTransactions(ctx, in.Store, in.Previous)
+		switch {
+		case errors.Is(err, blob.ErrNotExist):
+			fmt.Printf("Previous transactions %s not found, changes are not listed\n", in.Previous)
+		case err != nil:
+			return fail("read previous transactions", in.Previous, err)
+		default:
+			prevStudents = maps.Clone(students)
+			override.Apply(aliases, prevDonations)
+			campaign.Tag(rules, prevDonations)
+			alloc.AssignWith(prevStudents, prevDonations, opts.Policy)
+		}
+	}
+
+	result := alloc.AssignWith(students, donations, opts.Policy)
+
+	// The report has as many care giver and primary donor columns as
+	// the student with the most of them needs
+	careGivers, donors := donationsByStudentColumns(students)
+	donationsByStudentHeader := donationsByStudentHeader(careGivers, donors)
+
+	style, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Size:   10,
+			Family: "Calibri",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Determine the desired range of cells to format.
+	// For instance, you might typically use only up to Z (column 26) and 100 rows.
+	maxColumns := max(26, len(donationsByStudentHeader))
+	maxRows := 300
+
+	for col := 1; col <= maxColumns; col++ {
+		// colName, _ := excelize.ColumnNumberToName(col)
+		for row := 1; row <= maxRows; row++ {
+			cell, _ := excelize.CoordinatesToCellName(col, row)
+			if err := f.SetCellStyle(sheetName, cell, cell, style); err != nil {
+				return err
+			}
+		}
+	}
+
+	dollarAmountStyle, err := f.NewStyle(&excelize.Style{
+		NumFmt: 165,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Donation amount columns follow the care givers, the primary donors
+	// and the number of primary donors per student
+	firstAmountCol, err := excelize.ColumnNumberToName(careGivers + donors + 4)
+	if err != nil {
+		return err
+	}
+	lastAmountCol, err := excelize.ColumnNumberToName(len(donationsByStudentHeader))
+	if err != nil {
+		return err
+	}
+
+	err = f.SetColStyle(sheetName, firstAmountCol+":"+lastAmountCol, dollarAmountStyle)
+	if err != nil {
+		return err
+	}
+
+	err = f.SetCellValue(sheetName, "A1", "Last Updated:")
+	if err != nil {
+		return err
+	}
+
+	// Create a new style with a yellow background.
+	dateStyle, err := f.NewStyle(&excelize.Style{
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#FFFF00"}, // Yellow color in HEX format
+			Pattern: 1,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = f.SetCellStyle(sheetName, "B1", "B1", dateStyle)
+	if err != nil {
+		return err
+	}
+
+	err = f.SetCellValue(sheetName, "C1", "Sibling Split:")
+	if err != nil {
+		return err
+	}
+
+	err = f.SetCellValue(sheetName, "D1", opts.Policy.Name())
+	if err != nil {
+		return err
+	}
+
+	err = f.SetSheetRow(sheetName, "A2", &donationsByStudentHeader)
+	if err != nil {
+		return err
+	}
+	err = f.SetCellValue(sheetName, "B1", opts.ReportDate)
+	if err != nil {
+		return err
+	}
+
+	if err := f.SetColWidth(sheetName, "A", "A", 20); err != nil {
+		return err
+	}
+
+	// data contains the rows to be written to the worksheet.
+	// This slice of interface slices is what the excelize
+	// library expects to write to the worksheet.
+	var data [][]interface{}
+
+	for _, student := range students {
+		data = append(data, donationsByStudentRow(student, careGivers, donors))
+	}
+
+	for i := 3; i < (len(data) + 3); i++ {
+		err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i), &data[i-3])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Resize cells to accomodate value lenghts
+	err = xlsAdjustColumnsWidth(f, sheetName)
+	if err != nil {
+		return err
+	}
+
+	// Write the donations that don't name any student to the worksheet
+	// (separate sheet)
+	unattributedDonationsSheetName := "Unattributed Donations"
+
+	i, err = f.NewSheet(unattributedDonationsSheetName)
+	if err != nil {
+		return err
+	}
+
+	f.SetActiveSheet(i)
+
+	unattributedDonationsHeader := []interface{}{
+		"Date",
+		"Name",
+		"Amount",
+	}
+
+	err = f.SetSheetRow(unattributedDonationsSheetName, "A1", &unattributedDonationsHeader)
+	if err != nil {
+		return err
+	}
+
+	err = f.SetColStyle(unattributedDonationsSheetName, "C", dollarAmountStyle)
+	if err != nil {
+		return err
+	}
+
+	// Corrections may have given a transaction its students, so the
+	// corrected transactions are used rather than reading the file again
+	unattributedDonations := ingest.WithoutStudents(donations)
+
+	var unattributedDonationsData [][]interface{}
+
+	for _, donation := range unattributedDonations {
+		unattributedDonationsData = append(unattributedDonationsData, []interface{}{
+			donation.Date,
+			donation.Name,
+			donation.Amount.Dollars(),
+		})
+	}
+
+	for i := 2; i < (len(unattributedDonationsData) + 2); i++ {
+		err := f.SetSheetRow(
+			unattributedDonationsSheetName,
+			fmt.Sprintf("A%d", i),
+			&unattributedDonationsData[i-2],
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Resize cells to accomodate value lenghts
+	err = xlsAdjustColumnsWidth(f, unattributedDonationsSheetName)
+	if err != nil {
+		return err
+	}
+
+	// Every donation with who gave it, care giver or not
+	if err := writeDonorTypes(f, "Donations By Donor Type", donations, result.Kinds, dollarAmountStyle); err != nil {
+		return err
+	}
+
+	// How each class and grade is doing, ranked by participation
+	percentStyle, err := f.NewStyle(&excelize.Style{
+		NumFmt: 10,
+	})
+	if err != nil {
+		return err
+	}
+	school := schoolTotal(students)
+	byClass := summarize(students, func(s types.Student) string { return s.Class })
+	if err := writeSummary(f, "Donations By Class", "Class", byClass, school, dollarAmountStyle, percentStyle); err != nil {
+		return err
+	}
+	byGrade := summarize(students, gradeOf)
+	if err := writeSummary(f, "Donations By Grade", "Grade", byGrade, school, dollarAmountStyle, percentStyle); err != nil {
+		return err
+	}
+
+	// How close each goal of the campaign is to being met
+	progress, unmatchedGoals := goalProgress(goals, opts.Campaign, campaigns, school, byGrade, byClass)
+	for _, problem := range unmatchedGoals {
+		fmt.Println(problem)
+	}
+	goalProblems = append(goalProblems, unmatchedGoals...)
+
+	if len(progress) > 0 {
+		if err := writeGoals(f, "Progress To Goals", progress, dollarAmountStyle, percentStyle); err != nil {
+			return err
+		}
+	}
+
+	// What each student was given for each campaign, when the gifts
+	// were for more than one
+	if len(campaigns) > 0 {
+		if err := writeCampaigns(f, "Donations By Campaign", campaigns, students, dollarAmountStyle); err != nil {
+			return err
+		}
+	}
+
+	// Students no one has given for yet, for outreach
+	if err := writeNotParticipating(f, "Not Yet Participating", students); err != nil {
+		return err
+	}
+
+	// What changed since the last report, when it could be compared
+	if prevStudents != nil {
+		changes := compareReports(prevDonations, donations, prevStudents, students)
+		if err := writeChanges(f, "Changes Since Last Report", opts.PreviousDate, changes, dollarAmountStyle); err != nil {
+			return err
+		}
+	}
+
+	// Let the office know which roster rows need fixing
+	if len(rosterProblems) > 0 {
+		if err := writeRowErrors(f, "Roster Problems", rosterProblems); err != nil {
+			return err
+		}
+	}
+
+	// Refunds and chargebacks are listed with the gift they reversed
+	if len(result.Adjustments) > 0 {
+		if err := writeAdjustments(f, "Refunds & Adjustments", result.Adjustments, dollarAmountStyle); err != nil {
+			return err
+		}
+	}
+
+	// Student names that were guessed or not found, for a volunteer to confirm
+	if len(result.Matches) > 0 {
+		if err := writeMatches(f, "Unmatched & Fuzzy Matches", result.Matches, dollarAmountStyle); err != nil {
+			return err
+		}
+	}
+
+	// Every name correction applied is listed so that it can be audited
+	if len(corrections) > 0 {
+		if err := writeCorrections(f, "Name Corrections Applied", corrections, dollarAmountStyle); err != nil {
+			return err
+		}
+	}
+
+	if len(aliasProblems) > 0 {
+		if err := writeRowErrors(f, "Name Correction Problems", aliasProblems); err != nil {
+			return err
+		}
+	}
+
+	if len(ruleProblems) > 0 {
+		if err := writeRowErrors(f, "Campaign Rule Problems", ruleProblems); err != nil {
+			return err
+		}
+	}
+
+	if len(goalProblems) > 0 {
+		if err := writeRowErrors(f, "Goal Problems", goalProblems); err != nil {
+			return err
+		}
+	}
+
+	if len(exclusionProblems) > 0 {
+		if err := writeRowErrors(f, "Exclusion Problems", exclusionProblems); err != nil {
+			return err
+		}
+	}
+
+	// Donations that couldn't be read are left out of the totals
+	if len(txnProblems) > 0 {
+		if err := writeRowErrors(f, "Transaction Problems", txnProblems); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
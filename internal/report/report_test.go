@@ -0,0 +1,543 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/alloc"
+	"github.com/jotacamou/datacor/internal/blob"
+	"github.com/jotacamou/datacor/internal/campaign"
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/types"
+	"github.com/jotacamou/datacor/internal/xlsxtest"
+	excelize "github.com/xuri/excelize/v2"
+)
+
+func TestAddParent(t *testing.T) {
+	tests := []struct {
+		name       string
+		student    types.Student
+		parentName string
+		expected   types.Student
+	}{
+		{
+			name:       "Add first parent",
+			student:    types.Student{},
+			parentName: "Parent1",
+			expected:   types.Student{Parents: []string{"Parent1"}},
+		},
+		{
+			name:       "Add second parent",
+			student:    types.Student{Parents: []string{"Parent1"}},
+			parentName: "Parent2",
+			expected:   types.Student{Parents: []string{"Parent1", "Parent2"}},
+		},
+		{
+			name:       "Add third parent",
+			student:    types.Student{Parents: []string{"Parent1", "Parent2"}},
+			parentName: "Parent3",
+			expected:   types.Student{Parents: []string{"Parent1", "Parent2", "Parent3"}},
+		},
+		{
+			name:       "Add fourth parent",
+			student:    types.Student{Parents: []string{"Parent1", "Parent2", "Parent3"}},
+			parentName: "Parent4",
+			expected:   types.Student{Parents: []string{"Parent1", "Parent2", "Parent3", "Parent4"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addParent(&tt.student, tt.parentName)
+			if !reflect.DeepEqual(tt.student, tt.expected) {
+				t.Errorf("got %v, want %v", tt.student, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAddAccount(t *testing.T) {
+	student := types.Student{}
+	for _, account := range []string{"A1", "", "A2", "A1"} {
+		addAccount(&student, account)
+	}
+
+	if !reflect.DeepEqual(student.Accounts, []string{"A1", "A2"}) {
+		t.Errorf("got %v, want [A1 A2]", student.Accounts)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+
+	files := map[string][]byte{
+		RosterFile: xlsxtest.Workbook(t, [][]interface{}{
+			{"Parent Name", "Child 1 Name", "Child 1 Class", "Child 2 Name", "Child 2 Class"},
+			{"Jane Doe", "Sam Doe", "K", "Ana Doe", "2"},
+		}),
+		AliasesFile: xlsxtest.Workbook(t, [][]interface{}{
+			{"Type", "As Entered", "Donor Name"},
+			{"Donor", "Jayne Doe", "Jane Doe"},
+		}),
+		"2024-12-12-Report.xlsx": xlsxtest.Workbook(t, [][]interface{}{
+			{"Date", "Donor Name", "Amount", "Student 1 Name", "Student 2 Name"},
+			{"", "Total", "$130.00"},
+			{"12/01/2024", "Jayne Doe", "$100.00", "Sam Doe", "Ana Doe"},
+			{"12/02/2024", "Uncle Bob", "$30.00"},
+			{"12/03/2024", "Aunt May", "lots"},
+		}),
+	}
+	for name, data := range files {
+		if err := store.Write(ctx, name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := Generate(ctx, Inputs{Store: store, Transactions: "2024-12-12-Report.xlsx"}, Options{
+		Output:     "out.xlsx",
+		ReportDate: "12/12/2024",
+		Policy:     alloc.FirstNamed{},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := store.Read(ctx, "out.xlsx")
+	if err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	want := []string{"Donations By Student", "Unattributed Donations", "Donations By Donor Type", "Donations By Class", "Donations By Grade", "Not Yet Participating", "Name Corrections Applied", "Transaction Problems"}
+	if got := f.GetSheetList(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got sheets %v, want %v", got, want)
+	}
+
+	if policy, _ := f.GetCellValue("Donations By Student", "D1"); policy != "First named student only" {
+		t.Errorf("got policy %q", policy)
+	}
+
+	rows, err := f.GetRows("Donations By Student")
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := make(map[string]string)
+	for _, row := range rows[2:] {
+		totals[row[0]] = row[len(row)-3]
+	}
+	if totals["Sam Doe"] != "$100.00" || totals["Ana Doe"] != "$0.00" {
+		t.Errorf("unexpected totals: %v", totals)
+	}
+
+	// Ana's brother was given for, so her family is participating
+	rows, err = f.GetRows("Not Yet Participating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][1] != "Ana Doe" || rows[1][4] != "Yes" {
+		t.Errorf("unexpected not participating rows: %v", rows)
+	}
+}
+
+func TestGenerateCampaigns(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+
+	files := map[string][]byte{
+		RosterFile: xlsxtest.Workbook(t, [][]interface{}{
+			{"Parent Name", "Child 1 Name", "Child 1 Class"},
+			{"Jane Doe", "Sam Doe", "K"},
+		}),
+		CampaignsFile: xlsxtest.Workbook(t, [][]interface{}{
+			{"Campaign", "Memo Keyword"},
+			{"Field Trip", "zoo"},
+		}),
+		"2024-03-20-Report.xlsx": xlsxtest.Workbook(t, [][]interface{}{
+			{"Date", "Donor Name", "Amount", "Student Name", "Fund", "Memo"},
+			{"", "Total", "$80.00"},
+			{"03/01/2024", "Jane Doe", "$50.00", "Sam Doe", "Auction"},
+			{"03/02/2024", "Jane Doe", "$20.00", "Sam Doe", "", "Zoo trip"},
+			{"03/03/2024", "Jane Doe", "$10.00", "Sam Doe"},
+		}),
+	}
+	for name, data := range files {
+		if err := store.Write(ctx, name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := Generate(ctx, Inputs{Store: store, Transactions: "2024-03-20-Report.xlsx"}, Options{Output: "out.xlsx"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := store.Read(ctx, "out.xlsx")
+	if err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Donations By Campaign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Student", "Class", "Auction", "Field Trip", campaign.Untagged, "Total Donation Amount"},
+		{"Sam Doe", "K", "$50.00", "$20.00", "$10.00", "$80.00"},
+		{"Whole School", "", "$50.00", "$20.00", "$10.00", "$80.00"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got rows %q, want %q", rows, want)
+	}
+}
+
+func TestGenerateCSV(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+
+	files := map[string]string{
+		"roster.csv": "Parent Name,Child 1 Name,Child 1 Class\r\nJane Doe,Sam Doe,K\r\n",
+		"2024-12-12-Report.tsv": "\xEF\xBB\xBFDate\tDonor Name\tAmount\tStudent Name\n" +
+			"\tTotal\t$1,025.00\n" +
+			"12/01/2024\tJane Doe\t$1,000.00\tSam Doe\n" +
+			"12/02/2024\tUncle Bob\t$25.00\tSam Doe\n",
+	}
+	for name, data := range files {
+		if err := store.Write(ctx, name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := Generate(ctx, Inputs{Store: store, Transactions: "2024-12-12-Report.tsv", Roster: "roster.csv"}, Options{Output: "out.xlsx"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := store.Read(ctx, "out.xlsx")
+	if err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Donations By Student")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[2][0] != "Sam Doe" || rows[2][2] != "Jane Doe" || rows[2][len(rows[2])-3] != "$1,025.00" {
+		t.Errorf("unexpected report rows: %v", rows)
+	}
+}
+
+func TestUpdateHistory(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+
+	txns := "Date,Donor Name,Amount,Student Name\n,Total,$35.00\n12/01/2024,Jane Doe,$25.00,Sam Doe\n12/02/2024,Uncle Bob,$10.00,Sam Doe\n"
+	if err := store.Write(ctx, "2024-12-12-Report.csv", []byte(txns)); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 12, 12, 9, 0, 0, 0, time.UTC)
+	records, err := UpdateHistory(ctx, store, "2024-12-12-Report.csv", now)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("got %d records, %v, want 2", len(records), err)
+	}
+
+	// Without an upload the saved history is read back
+	records, err = UpdateHistory(ctx, store, "", now)
+	if err != nil || len(records) != 2 {
+		t.Errorf("got %d records, %v, want 2", len(records), err)
+	}
+}
+
+func TestHistoryEnd(t *testing.T) {
+	to := time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)
+	uploaded := time.Date(2024, 12, 12, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		to, uploaded, want time.Time
+	}{
+		{to, uploaded, to},
+		{time.Time{}, uploaded, uploaded},
+		{time.Time{}, time.Time{}, now},
+	}
+	for _, tt := range tests {
+		if got := HistoryEnd(tt.to, tt.uploaded, now); !got.Equal(tt.want) {
+			t.Errorf("HistoryEnd(%v, %v) = %v, want %v", tt.to, tt.uploaded, got, tt.want)
+		}
+	}
+}
+
+func TestCompareReports(t *testing.T) {
+	students := make(types.AllStudents)
+	for _, student := range []types.Student{
+		{Name: "Sam Doe", Class: "K"},
+		{Name: "Ana Doe", Class: "2"},
+		{Name: "Max Roe", Class: "1"},
+	} {
+		students[student.Key()] = student
+	}
+	prevStudents := maps.Clone(students)
+
+	gift := func(date, name string, amount money.Cents, student string) *types.DonationTransaction {
+		return &types.DonationTransaction{Date: date, Name: name, Amount: amount, Students: []types.StudentRef{{Name: student}}}
+	}
+	prev := []*types.DonationTransaction{
+		gift("12/01/2024", "Jane Doe", 5000, "Sam Doe"),
+		gift("12/02/2024", "Bob Roe", 1000, "Max Roe"),
+	}
+	current := []*types.DonationTransaction{
+		gift("12/01/2024", "Jane Doe", 5000, "Sam Doe"),
+		gift("12/02/2024", "Bob Roe", 1000, "Max Roe"),
+		gift("12/09/2024", "Bob Roe", 500, "Max Roe"),
+		gift("12/10/2024", "Aunt May", 2000, "Ana Doe"),
+	}
+	alloc.Assign(prevStudents, prev)
+	alloc.Assign(students, current)
+
+	changes := compareReports(prev, current, prevStudents, students)
+
+	want := []change{
+		{Kind: newDonation, Date: "12/09/2024", Name: "Bob Roe", Current: 500},
+		{Kind: newDonation, Date: "12/10/2024", Name: "Aunt May", Current: 2000},
+		{Kind: newDonor, Date: "12/10/2024", Name: "Aunt May", Current: 2000},
+		{Kind: totalChanged, Name: "Max Roe", Class: "1", Previous: 1000, Current: 1500},
+		{Kind: startedGiving, Name: "Ana Doe", Class: "2", Previous: 0, Current: 2000},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got %+v, want %+v", changes, want)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	// gifts returns a share of a new gift for every amount
+	gifts := func(amounts ...money.Cents) map[*types.DonationTransaction]money.Cents {
+		shares := make(map[*types.DonationTransaction]money.Cents)
+		for _, amount := range amounts {
+			shares[&types.DonationTransaction{Amount: amount}] = amount
+		}
+		return shares
+	}
+
+	students := make(types.AllStudents)
+	for _, student := range []types.Student{
+		// Siblings in one class are one family
+		{Name: "Sam Doe", Class: "K-Rivera", Accounts: []string{"100"}, TotalDonationAmount: 5000, Gifts: gifts(2500, 2500)},
+		{Name: "Ana Doe", Class: "K-Rivera", Accounts: []string{"100"}},
+		{Name: "Max Roe", Class: "K-Rivera", Parents: []string{"Bob Roe"}},
+		{Name: "Kim Poe", Class: "K-Lee", Parents: []string{"Pat Poe"}, TotalDonationAmount: 1000, Gifts: gifts(1000)},
+		{Name: "Lou Loe", Class: "3B", Grade: "3", Parents: []string{"Lee Loe"}, TotalDonationAmount: 1000, Gifts: gifts(1000)},
+		{Name: "Zed Zoe", Class: "3A", Parents: []string{"Zia Zoe"}, TotalDonationAmount: 2500, Gifts: gifts(2500)},
+	} {
+		students[student.Key()] = student
+	}
+
+	byClass := summarize(students, func(s types.Student) string { return s.Class })
+	want := []groupSummary{
+		{Group: "3A", Students: 1, ParticipatingStudents: 1, Families: 1, DonatingFamilies: 1, Total: 2500, Gifts: 1, Rank: 1},
+		{Group: "3B", Students: 1, ParticipatingStudents: 1, Families: 1, DonatingFamilies: 1, Total: 1000, Gifts: 1, Rank: 2},
+		{Group: "K-Lee", Students: 1, ParticipatingStudents: 1, Families: 1, DonatingFamilies: 1, Total: 1000, Gifts: 1, Rank: 2},
+		{Group: "K-Rivera", Students: 3, ParticipatingStudents: 1, Families: 2, DonatingFamilies: 1, Total: 5000, Gifts: 2, Rank: 4},
+	}
+	if !reflect.DeepEqual(byClass, want) {
+		t.Errorf("by class got %+v, want %+v", byClass, want)
+	}
+	if got := byClass[3].Participation(); got != 0.5 {
+		t.Errorf("K-Rivera participation got %v, want 0.5", got)
+	}
+	if got := byClass[3].AverageGift(); got != 2500 {
+		t.Errorf("K-Rivera average gift got %v, want 2500", got)
+	}
+
+	byGrade := summarize(students, gradeOf)
+	want = []groupSummary{
+		{Group: "3", Students: 2, ParticipatingStudents: 2, Families: 2, DonatingFamilies: 2, Total: 3500, Gifts: 2, Rank: 1},
+		{Group: "K", Students: 4, ParticipatingStudents: 2, Families: 3, DonatingFamilies: 2, Total: 6000, Gifts: 3, Rank: 2},
+	}
+	if !reflect.DeepEqual(byGrade, want) {
+		t.Errorf("by grade got %+v, want %+v", byGrade, want)
+	}
+
+	school := schoolTotal(students)
+	if school.Families != 5 || school.DonatingFamilies != 4 || school.Total != 9500 {
+		t.Errorf("school got %+v", school)
+	}
+}
+
+func TestSummarizeCountsGifts(t *testing.T) {
+	students := make(types.AllStudents)
+	for _, student := range []types.Student{
+		{Name: "Sam Doe", Class: "K-Rivera", Parents: []string{"Jane Doe"}},
+		{Name: "Ana Doe", Class: "K-Rivera", Parents: []string{"Jane Doe"}},
+	} {
+		students[student.Key()] = student
+	}
+
+	// One gift for both siblings, and one refunded in full
+	siblings := []types.StudentRef{{Name: "Sam Doe"}, {Name: "Ana Doe"}}
+	alloc.Assign(students, []*types.DonationTransaction{
+		{Row: 2, Date: "12/01/2024", Name: "Jane Doe", Amount: 10000, Students: siblings},
+		{Row: 3, Date: "12/02/2024", Name: "Uncle Bob", Amount: 2000, Students: siblings[:1]},
+		{Row: 4, Date: "12/03/2024", Name: "Uncle Bob", Amount: -2000, Students: siblings[:1]},
+	})
+
+	byClass := summarize(students, func(s types.Student) string { return s.Class })
+	if len(byClass) != 1 || byClass[0].Gifts != 1 || byClass[0].AverageGift() != 10000 {
+		t.Errorf("got %+v, want 1 gift averaging $100", byClass)
+	}
+}
+
+func TestApplyExclusions(t *testing.T) {
+	students := make(types.AllStudents)
+	for _, student := range []types.Student{
+		{Name: "Sam Doe", Class: "K", Accounts: []string{"A7"}},
+		{Name: "Ana Doe", Class: "2", Accounts: []string{"A7"}},
+		{Name: "Max Roe", Class: "K", Parents: []string{"Bob Roe"}},
+		{Name: "Kim Poe", Class: "K", Parents: []string{"Pat Poe"}, TotalDonationAmount: 1000},
+		{Name: "Lou Poe", Class: "2", Parents: []string{"Pat Poe"}},
+	} {
+		students[student.Key()] = student
+	}
+
+	unmatched := applyExclusions(students, []types.Exclusion{
+		{Row: 2, Account: "a7"},
+		{Row: 3, Student: types.StudentRef{Name: "Max Roe", Class: "1"}},
+	})
+
+	if len(unmatched) != 1 || unmatched[0].Row != 3 {
+		t.Errorf("unexpected unmatched exclusions: %+v", unmatched)
+	}
+	for _, student := range students {
+		if want := student.Name == "Sam Doe" || student.Name == "Ana Doe"; student.Excluded != want {
+			t.Errorf("%s excluded %v, want %v", student.Name, student.Excluded, want)
+		}
+	}
+
+	// The scholarship family is left out of the rates but not the counts
+	school := schoolTotal(students)
+	if school.Students != 5 || school.Excluded != 2 || school.ParticipatingStudents != 1 || school.Families != 2 || school.DonatingFamilies != 1 {
+		t.Errorf("school got %+v", school)
+	}
+	if got := school.StudentParticipation(); got != 1.0/3 {
+		t.Errorf("student participation got %v, want 1/3", got)
+	}
+	if families := participatingFamilies(students); len(families) != 1 {
+		t.Errorf("participating families got %v", families)
+	}
+}
+
+func TestGoalProgress(t *testing.T) {
+	school := groupSummary{Group: "School", Total: 60000, Campaigns: map[string]money.Cents{"field trip": 20000}}
+	byGrade := []groupSummary{{Group: "K", Total: 45000}}
+	byClass := []groupSummary{{Group: "K-Rivera", Total: 30000, Campaigns: map[string]money.Cents{"field trip": 12000}}, {Group: "K-Lee", Total: 15000}}
+
+	goals := []types.Goal{
+		{Class: "K-Lee", Amount: 10000},
+		{Campaign: "Auction", Amount: 500000},
+		{Amount: 100000},
+		{Grade: "k", Amount: 50000},
+		{Row: 6, Class: "1-Park", Amount: 20000},
+		{Campaign: "Field Trip", Class: "K-Rivera", Amount: 15000},
+		{Row: 8, Grade: "5", Amount: 20000},
+	}
+
+	got, problems := goalProgress(goals, "Annual Fund", []string{"Field Trip", campaign.Untagged}, school, byGrade, byClass)
+	want := []progress{
+		{Level: "School", Name: "Whole School", Goal: 100000, Raised: 60000},
+		{Level: "Grade", Name: "k", Goal: 50000, Raised: 45000},
+		{Level: "Class", Name: "K-Lee", Goal: 10000, Raised: 15000},
+		{Campaign: "Field Trip", Level: "Class", Name: "K-Rivera", Goal: 15000, Raised: 12000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	// The profile's campaign counts everything only when no gift was
+	// tagged with it
+	fieldTrip := []types.Goal{{Campaign: "Field Trip", Amount: 25000}}
+	if got, _ := goalProgress(fieldTrip, "Field Trip", []string{"Field Trip", campaign.Untagged}, school, byGrade, byClass); len(got) != 1 || got[0].Raised != 20000 {
+		t.Errorf("tagged profile campaign got %+v, want $200 raised", got)
+	}
+	if got, _ := goalProgress(fieldTrip, "Field Trip", nil, school, byGrade, byClass); len(got) != 1 || got[0].Raised != 60000 {
+		t.Errorf("untagged profile campaign got %+v, want $600 raised", got)
+	}
+
+	// Goals for groups without students aren't shown as nothing raised
+	if len(problems) != 2 || problems[0].Row != 6 || problems[0].Column != "Class" || problems[1].Row != 8 || problems[1].Column != "Grade" {
+		t.Errorf("unexpected problems: %+v", problems)
+	}
+	if got[0].Complete() != 0.6 || got[0].Remaining() != 40000 {
+		t.Errorf("unexpected school progress: %v, %v", got[0].Complete(), got[0].Remaining())
+	}
+	if got[2].Complete() != 1.5 || got[2].Remaining() != 0 {
+		t.Errorf("unexpected class progress: %v, %v", got[2].Complete(), got[2].Remaining())
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := writeGoals(f, "Progress To Goals", got, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	formats, err := f.GetConditionalFormats("Progress To Goals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules := formats["F2:F5"]; len(rules) != 3 {
+		t.Errorf("got conditional formats %+v, want red, amber and green on F2:F5", formats)
+	}
+}
+
+// brokenStore fails every write, like a storage outage.
+type brokenStore struct {
+	*blob.Memory
+}
+
+func (brokenStore) Write(ctx context.Context, name string, data []byte) error {
+	return errors.New("service unavailable")
+}
+
+func TestGenerateErrors(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+	in := Inputs{Store: store, Transactions: "2024-12-12-Report.xlsx"}
+
+	err := Generate(ctx, in, Options{Output: "out.xlsx"})
+	var reportErr *Error
+	if !errors.As(err, &reportErr) || reportErr.Stage != "read roster" || IsRetryable(err) || !errors.Is(err, blob.ErrNotExist) {
+		t.Errorf("missing roster: got %v", err)
+	}
+
+	if err := store.Write(ctx, RosterFile, []byte("not a workbook")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Generate(ctx, in, Options{Output: "out.xlsx"}); IsRetryable(err) || err == nil {
+		t.Errorf("corrupt roster: got %v", err)
+	}
+
+	store.Write(ctx, RosterFile, xlsxtest.Workbook(t, [][]interface{}{{"Parent Name", "Child Name", "Child Class"}}))
+	store.Write(ctx, in.Transactions, xlsxtest.Workbook(t, [][]interface{}{{"Date", "Donor Name", "Amount", "Student Name"}}))
+
+	in.Store = brokenStore{store}
+	if err := Generate(ctx, in, Options{Output: "out.xlsx"}); !IsRetryable(err) {
+		t.Errorf("failed write: got %v, want a retryable error", err)
+	}
+}
@@ -0,0 +1,344 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jotacamou/datacor/internal/alloc"
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/override"
+	"github.com/jotacamou/datacor/internal/schema"
+	"github.com/jotacamou/datacor/internal/types"
+	excelize "github.com/xuri/excelize/v2"
+)
+
+// donationsByStudentColumns returns how many care giver and primary
+// donor columns are needed to fit every student.  There are never less
+// than three of each so the usual layout of the report is kept.
+func donationsByStudentColumns(students types.AllStudents) (int, int) {
+	careGivers, donors := 3, 3
+	for _, student := range students {
+		careGivers = max(careGivers, len(student.Parents))
+		donors = max(donors, len(student.PrimaryDonors))
+	}
+	return careGivers, donors
+}
+
+// donationsByStudentHeader returns the header of the donations by student
+// sheet for the given number of care giver and primary donor columns.
+func donationsByStudentHeader(careGivers, donors int) []interface{} {
+	header := []interface{}{
+		"Student",
+		"Class",
+	}
+	for i := 1; i <= careGivers; i++ {
+		header = append(header, fmt.Sprintf("Care Giver %d", i))
+	}
+	for i := 1; i <= donors; i++ {
+		header = append(header, fmt.Sprintf("Primary Donor %d", i))
+	}
+	header = append(header, "Primary Donors Per Student")
+	for i := 1; i <= donors; i++ {
+		header = append(header, fmt.Sprintf("Primary Donor %d Donation Amount", i))
+	}
+	return append(header, "Total Donation Amount", "Care Giver Donations", "Other Donations")
+}
+
+// donationsByStudentRow returns the row of the donations by student sheet
+// for a student, padded to the given number of care giver and primary
+// donor columns.
+func donationsByStudentRow(student types.Student, careGivers, donors int) []interface{} {
+	row := []interface{}{
+		student.Name,
+		student.Class,
+	}
+	for i := 0; i < careGivers; i++ {
+		name := ""
+		if i < len(student.Parents) {
+			name = student.Parents[i]
+		}
+		row = append(row, name)
+	}
+	for i := 0; i < donors; i++ {
+		name := ""
+		if i < len(student.PrimaryDonors) {
+			name = student.PrimaryDonors[i].Name
+		}
+		row = append(row, name)
+	}
+	row = append(row, len(student.PrimaryDonors))
+	for i := 0; i < donors; i++ {
+		var amount money.Cents
+		if i < len(student.PrimaryDonors) {
+			amount = student.PrimaryDonors[i].Amount
+		}
+		row = append(row, amount.Dollars())
+	}
+	return append(row,
+		student.TotalDonationAmount.Dollars(),
+		student.CareGiverAmount.Dollars(),
+		student.OtherAmount.Dollars(),
+	)
+}
+
+// Auto adjust column width based on the content
+func xlsAdjustColumnsWidth(f *excelize.File, sheet string) error {
+	cols, err := f.GetCols(sheet)
+	if err != nil {
+		return err
+	}
+
+	for idx, col := range cols {
+		largestWidth := 0
+		for _, rowCell := range col {
+			cellWidth := utf8.RuneCountInString(rowCell)
+			// cellWidth := utf8.RuneCountInString(rowCell) + 2
+			if cellWidth > largestWidth {
+				largestWidth = cellWidth
+			}
+		}
+		name, err := excelize.ColumnNumberToName(idx + 1)
+		if err != nil {
+			return err
+		}
+
+		err = f.SetColWidth(sheet, name, name, float64(largestWidth))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeDonorTypes writes every transaction and whether it came from a
+// care giver of the students it was assigned to, from extended family
+// and friends, or couldn't be attributed to any student.
+func writeDonorTypes(f *excelize.File, sheetName string, donations []*types.DonationTransaction, kinds map[*types.DonationTransaction]types.DonorKind, dollarAmountStyle int) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Row",
+		"Date",
+		"Donor",
+		"Amount",
+		"Donor Type",
+		"Students",
+	}
+
+	if err := f.SetSheetRow(sheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	if err := f.SetColStyle(sheetName, "D", dollarAmountStyle); err != nil {
+		return err
+	}
+
+	for i, txn := range donations {
+		row := []interface{}{
+			txn.Row,
+			txn.Date,
+			txn.Name,
+			txn.Amount.Dollars(),
+			string(kinds[txn]),
+			strings.Join(txn.StudentNames(), ", "),
+		}
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
+
+// writeRowErrors writes problems found in an input sheet to a new sheet
+// of the report.
+func writeRowErrors(f *excelize.File, sheetName string, problems []schema.RowError) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Sheet",
+		"Row",
+		"Column",
+		"Problem",
+	}
+
+	if err := f.SetSheetRow(sheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	for i, problem := range problems {
+		row := []interface{}{
+			problem.Sheet,
+			problem.Row,
+			problem.Column,
+			problem.Reason,
+		}
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
+
+// writeAdjustments writes the refunds and chargebacks, and the gifts they
+// were matched to, to a new sheet of the report.
+func writeAdjustments(f *excelize.File, sheetName string, adjustments []alloc.Adjustment, dollarAmountStyle int) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Date",
+		"Name",
+		"Amount",
+		"Account Number",
+		"Original Date",
+		"Original Amount",
+		"Students",
+		"Note",
+	}
+
+	if err := f.SetSheetRow(sheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	if err := f.SetColStyle(sheetName, "C", dollarAmountStyle); err != nil {
+		return err
+	}
+	if err := f.SetColStyle(sheetName, "F", dollarAmountStyle); err != nil {
+		return err
+	}
+
+	for i, adj := range adjustments {
+		row := []interface{}{
+			adj.Refund.Date,
+			adj.Refund.Name,
+			adj.Refund.Amount.Dollars(),
+			adj.Refund.AccountNumber,
+			"",
+			"",
+			strings.Join(adj.Students, ", "),
+			adj.Note,
+		}
+		if adj.Original != nil {
+			row[4] = adj.Original.Date
+			row[5] = adj.Original.Amount.Dollars()
+		}
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
+
+// writeMatches writes the students named on gifts that were matched by a
+// normalized, nickname or fuzzy name, or not matched at all, so that a
+// volunteer can confirm or correct them.
+func writeMatches(f *excelize.File, sheetName string, matches []alloc.StudentMatch, dollarAmountStyle int) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Row",
+		"Date",
+		"Donor",
+		"Student As Entered",
+		"Class As Entered",
+		"Matched Student",
+		"Matched Class",
+		"Match Type",
+		"Confidence",
+		"Share",
+		"Reason",
+		"Confirm / Correct To",
+	}
+
+	if err := f.SetSheetRow(sheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	if err := f.SetColStyle(sheetName, "J", dollarAmountStyle); err != nil {
+		return err
+	}
+
+	for i, m := range matches {
+		row := []interface{}{
+			m.Txn.Row,
+			m.Txn.Date,
+			m.Txn.Name,
+			m.Ref.Name,
+			m.Ref.Class,
+			m.Match.Student.Name,
+			m.Match.Student.Class,
+			string(m.Match.Method),
+			fmt.Sprintf("%.0f%%", m.Match.Confidence*100),
+			m.Share.Dollars(),
+			m.Match.Reason,
+			"",
+		}
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
+
+// writeCorrections writes the name corrections applied to the
+// transactions, and the row of the corrections sheet each came from.
+func writeCorrections(f *excelize.File, sheetName string, corrections []override.Applied, dollarAmountStyle int) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Row",
+		"Date",
+		"Donor",
+		"Amount",
+		"Type",
+		"As Entered",
+		"Corrected To",
+		"Correction Row",
+		"Note",
+	}
+
+	if err := f.SetSheetRow(sheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	if err := f.SetColStyle(sheetName, "D", dollarAmountStyle); err != nil {
+		return err
+	}
+
+	for i, c := range corrections {
+		row := []interface{}{
+			c.Txn.Row,
+			c.Txn.Date,
+			c.Txn.Name,
+			c.Txn.Amount.Dollars(),
+			string(c.Alias.Kind),
+			c.Before,
+			c.After,
+			c.Alias.Row,
+			c.Alias.Note,
+		}
+		if c.Before == "" {
+			row[5] = "Account " + c.Txn.AccountNumber
+		}
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
@@ -0,0 +1,256 @@
+package report
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jotacamou/datacor/internal/campaign"
+	"github.com/jotacamou/datacor/internal/money"
+	"github.com/jotacamou/datacor/internal/types"
+	excelize "github.com/xuri/excelize/v2"
+)
+
+// groupSummary sums up the giving of the students of a class or grade.
+type groupSummary struct {
+	Group    string
+	Students int
+	// Excluded students are left out of the participation rates
+	Excluded              int
+	ParticipatingStudents int
+	Families              int
+	DonatingFamilies      int
+	Total                 money.Cents
+	// Gifts counts the gifts given for the group's students that weren't
+	// refunded in full; a gift shared by siblings is one gift
+	Gifts int
+	// Campaigns splits the total by campaign.Key
+	Campaigns map[string]money.Cents
+	// Rank orders the groups by participation, then by total raised.
+	// Groups that are level share a rank.
+	Rank int
+}
+
+// Participation is the share of the group's families that gave.
+func (g groupSummary) Participation() float64 {
+	if g.Families == 0 {
+		return 0
+	}
+	return float64(g.DonatingFamilies) / float64(g.Families)
+}
+
+// StudentParticipation is the share of the group's students that were
+// given for.
+func (g groupSummary) StudentParticipation() float64 {
+	counted := g.Students - g.Excluded
+	if counted == 0 {
+		return 0
+	}
+	return float64(g.ParticipatingStudents) / float64(counted)
+}
+
+// AverageGift is the amount raised per gift.
+func (g groupSummary) AverageGift() money.Cents {
+	if g.Gifts == 0 {
+		return 0
+	}
+	return g.Total / money.Cents(g.Gifts)
+}
+
+// familyKey identifies the family of a student: its first family account
+// or, without one, its care givers.  Siblings share a family.
+func familyKey(student types.Student) string {
+	if len(student.Accounts) > 0 {
+		return "account:" + normalize(student.Accounts[0])
+	}
+	parents := make([]string, len(student.Parents))
+	for i, parent := range student.Parents {
+		parents[i] = normalize(parent)
+	}
+	sort.Strings(parents)
+	return "parents:" + strings.Join(parents, ";")
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// gradePrefix finds the grade a class name starts with, e.g. K in
+// "K-Rivera" or 3 in "3B".
+var gradePrefix = regexp.MustCompile(`(?i)^\s*(tk|pk|k|\d+)`)
+
+// gradeOf returns the grade of the student from the roster or, when the
+// roster has no grade, from the start of its class name.
+func gradeOf(student types.Student) string {
+	if student.Grade != "" {
+		return student.Grade
+	}
+	if m := gradePrefix.FindStringSubmatch(student.Class); m != nil {
+		return strings.ToUpper(m[1])
+	}
+	return ""
+}
+
+// summarize sums up the students by the group returned by groupOf and
+// ranks the groups.  A family counts once in each group it has students
+// in, and has given when any of those students was given to.  Excluded
+// students count towards the totals raised but not the participation.
+func summarize(students types.AllStudents, groupOf func(types.Student) string) []groupSummary {
+	byGroup := make(map[string]*groupSummary)
+	families := make(map[string]map[string]bool)
+	gifts := make(map[string]map[*types.DonationTransaction]money.Cents)
+
+	for _, student := range students {
+		group := groupOf(student)
+		g, ok := byGroup[group]
+		if !ok {
+			g = &groupSummary{Group: group}
+			byGroup[group] = g
+			families[group] = make(map[string]bool)
+			gifts[group] = make(map[*types.DonationTransaction]money.Cents)
+		}
+
+		g.Students++
+		g.Total += student.TotalDonationAmount
+		for gift, amount := range student.Gifts {
+			gifts[group][gift] += amount
+		}
+		for name, amount := range student.Campaigns {
+			if g.Campaigns == nil {
+				g.Campaigns = make(map[string]money.Cents)
+			}
+			if name == "" {
+				name = campaign.Untagged
+			}
+			g.Campaigns[campaign.Key(name)] += amount
+		}
+
+		if student.Excluded {
+			g.Excluded++
+			continue
+		}
+
+		family := familyKey(student)
+		gave := participating(student)
+		if gave {
+			g.ParticipatingStudents++
+		}
+		families[group][family] = families[group][family] || gave
+	}
+
+	var summaries []groupSummary
+	for group, g := range byGroup {
+		g.Families = len(families[group])
+		for _, gave := range families[group] {
+			if gave {
+				g.DonatingFamilies++
+			}
+		}
+		for _, amount := range gifts[group] {
+			if amount > 0 {
+				g.Gifts++
+			}
+		}
+		summaries = append(summaries, *g)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Participation() != b.Participation() {
+			return a.Participation() > b.Participation()
+		}
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Group < b.Group
+	})
+
+	for i := range summaries {
+		summaries[i].Rank = i + 1
+		if i > 0 && summaries[i].Participation() == summaries[i-1].Participation() && summaries[i].Total == summaries[i-1].Total {
+			summaries[i].Rank = summaries[i-1].Rank
+		}
+	}
+
+	return summaries
+}
+
+// schoolTotal sums up every group for the school.
+func schoolTotal(students types.AllStudents) groupSummary {
+	summaries := summarize(students, func(types.Student) string { return "School" })
+	if len(summaries) == 0 {
+		return groupSummary{Group: "School"}
+	}
+	return summaries[0]
+}
+
+// writeSummary writes the groups, ranked, and the school total to a new
+// sheet of the report.
+func writeSummary(f *excelize.File, sheetName, groupName string, summaries []groupSummary, school groupSummary, dollarAmountStyle, percentStyle int) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+
+	header := []interface{}{
+		"Rank",
+		groupName,
+		"Students",
+		"Excluded Students",
+		"Participating Students",
+		"Student Participation",
+		"Families",
+		"Donating Families",
+		"Family Participation",
+		"Total Raised",
+		"Gifts",
+		"Average Gift",
+	}
+
+	if err := f.SetSheetRow(sheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	for _, col := range []string{"F", "I"} {
+		if err := f.SetColStyle(sheetName, col, percentStyle); err != nil {
+			return err
+		}
+	}
+	for _, col := range []string{"J", "L"} {
+		if err := f.SetColStyle(sheetName, col, dollarAmountStyle); err != nil {
+			return err
+		}
+	}
+
+	school.Rank = 0
+	for i, g := range append(summaries, school) {
+		rank := interface{}(g.Rank)
+		name := g.Group
+		switch {
+		case i == len(summaries):
+			rank, name = "", "Whole School"
+		case name == "":
+			name = "Unknown"
+		}
+
+		row := []interface{}{
+			rank,
+			name,
+			g.Students,
+			g.Excluded,
+			g.ParticipatingStudents,
+			g.StudentParticipation(),
+			g.Families,
+			g.DonatingFamilies,
+			g.Participation(),
+			g.Total.Dollars(),
+			g.Gifts,
+			g.AverageGift().Dollars(),
+		}
+		if err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+
+	return xlsAdjustColumnsWidth(f, sheetName)
+}
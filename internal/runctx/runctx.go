@@ -9,10 +9,16 @@ import (
 type RunContext struct {
 	NewTxnReport  string
 	PrevTxnReport string
+	// From and To limit a report on the donation history to a period
+	From time.Time
+	To   time.Time
 }
 
 func (ctx *RunContext) GetNewReportDate() string {
 	parts := strings.Split(ctx.NewTxnReport, "-")
+	if len(parts) < 3 {
+		return ""
+	}
 	t, err := time.Parse("2006-01-02", fmt.Sprintf("%s-%s-%s", parts[0], parts[1], parts[2]))
 	if err != nil {
 		fmt.Println(err)
@@ -0,0 +1,163 @@
+// Package runs keeps track of the uploads the report has been run for.
+// Cloud Storage delivers events at least once, so the same upload can
+// trigger the function more than once; the ledger lets a repeated event
+// be skipped, and a lock keeps two uploads for the same date from
+// writing the same report at once.
+package runs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/blob"
+)
+
+// Prefixes of the ledger entries and locks in the store
+const (
+	LedgerPrefix = "runs/"
+	LockPrefix   = "locks/"
+)
+
+// ErrLocked is returned by Acquire when another run holds the lock.
+var ErrLocked = errors.New("another run is in progress")
+
+// Entry records an upload that was processed.
+type Entry struct {
+	Upload   string    `json:"upload"`
+	Key      string    `json:"key"`
+	Output   string    `json:"output"`
+	Finished time.Time `json:"finished"`
+}
+
+// Key identifies a version of an upload: its generation when known,
+// otherwise its MD5 hash.  Uploading the same name again gives a new
+// generation, which is processed again.
+func Key(generation int64, md5 string) string {
+	if generation != 0 {
+		return fmt.Sprintf("g%d", generation)
+	}
+	if md5 != "" {
+		return "md5-" + md5
+	}
+	return "unknown"
+}
+
+// Ledger records the processed uploads in the store.
+type Ledger struct {
+	store blob.Store
+}
+
+// NewLedger returns the ledger kept in store.
+func NewLedger(store blob.Store) *Ledger {
+	return &Ledger{store: store}
+}
+
+func (l *Ledger) name(upload, key string) string {
+	return LedgerPrefix + upload + "/" + key + ".json"
+}
+
+// Done reports whether the version of the upload was already processed.
+func (l *Ledger) Done(ctx context.Context, upload, key string) (bool, error) {
+	_, err := l.store.Read(ctx, l.name(upload, key))
+	if errors.Is(err, blob.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Record marks the version of the upload as processed.
+func (l *Ledger) Record(ctx context.Context, entry Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return l.store.Write(ctx, l.name(entry.Upload, entry.Key), data)
+}
+
+// Lock is held by a run while it writes a report.
+type Lock struct {
+	store blob.Store
+	name  string
+	// data is what the lock holds while it's ours
+	data []byte
+}
+
+// lockInfo is the content of a lock.
+type lockInfo struct {
+	Holder   string    `json:"holder"`
+	Acquired time.Time `json:"acquired"`
+}
+
+// Acquire takes the lock for a report.  A lock older than ttl was left by
+// a run that didn't finish, such as one that timed out, and is taken
+// over; ttl must be longer than a run can take.  The takeover only
+// succeeds if the lock is still the stale one that was read, so two runs
+// finding the same stale lock don't both take it.  ErrLocked is returned
+// when another run holds the lock.
+func Acquire(ctx context.Context, store blob.Store, report, holder string, now time.Time, ttl time.Duration) (*Lock, error) {
+	lock := &Lock{store: store, name: LockPrefix + report + ".lock"}
+
+	data, err := json.Marshal(lockInfo{Holder: holder, Acquired: now.UTC()})
+	if err != nil {
+		return nil, err
+	}
+	lock.data = data
+
+	err = store.Create(ctx, lock.name, data)
+	if !errors.Is(err, blob.ErrExist) {
+		if err != nil {
+			return nil, err
+		}
+		return lock, nil
+	}
+
+	existing, err := store.Read(ctx, lock.name)
+	if errors.Is(err, blob.ErrNotExist) {
+		// Released since, try once more
+		err = store.Create(ctx, lock.name, data)
+		if errors.Is(err, blob.ErrExist) {
+			return nil, fmt.Errorf("%s: %w", report, ErrLocked)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return lock, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var info lockInfo
+	if json.Unmarshal(existing, &info) == nil && now.Sub(info.Acquired) < ttl {
+		return nil, fmt.Errorf("%s is locked by %s since %s: %w", report, info.Holder, info.Acquired.Format(time.RFC3339), ErrLocked)
+	}
+
+	err = store.Replace(ctx, lock.name, existing, data)
+	if errors.Is(err, blob.ErrChanged) || errors.Is(err, blob.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", report, ErrLocked)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// Release gives up the lock, unless another run has taken it over.
+func (l *Lock) Release(ctx context.Context) error {
+	current, err := l.store.Read(ctx, l.name)
+	if errors.Is(err, blob.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, l.data) {
+		return nil
+	}
+	return l.store.Delete(ctx, l.name)
+}
@@ -0,0 +1,105 @@
+package runs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/blob"
+)
+
+func TestLedger(t *testing.T) {
+	ctx := context.Background()
+	ledger := NewLedger(blob.NewMemory())
+	upload := "2024-12-12-Report.xlsx"
+
+	if done, err := ledger.Done(ctx, upload, Key(7, "")); done || err != nil {
+		t.Fatalf("got %v, %v before recording", done, err)
+	}
+
+	if err := ledger.Record(ctx, Entry{Upload: upload, Key: Key(7, "")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if done, err := ledger.Done(ctx, upload, Key(7, "")); !done || err != nil {
+		t.Errorf("got %v, %v after recording", done, err)
+	}
+	if done, _ := ledger.Done(ctx, upload, Key(8, "")); done {
+		t.Errorf("a new generation of the upload was taken as processed")
+	}
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+	now := time.Date(2024, 12, 12, 15, 0, 0, 0, time.UTC)
+	report := "donations_by_student-2024-12-12.xlsx"
+
+	lock, err := Acquire(ctx, store, report, "first", now, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Acquire(ctx, store, report, "second", now.Add(time.Minute), 10*time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v, want ErrLocked", err)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire(ctx, store, report, "second", now.Add(time.Minute), 10*time.Minute); err != nil {
+		t.Errorf("released lock not acquired: %v", err)
+	}
+
+	// The second run never released the lock
+	if _, err := Acquire(ctx, store, report, "third", now.Add(time.Hour), 10*time.Minute); err != nil {
+		t.Errorf("stale lock not taken over: %v", err)
+	}
+}
+
+// staleStore reads a lock as it was before another run took it over.
+type staleStore struct {
+	*blob.Memory
+	stale []byte
+}
+
+func (s staleStore) Read(ctx context.Context, name string) ([]byte, error) {
+	return s.stale, nil
+}
+
+func TestLockTakeOverOnce(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemory()
+	now := time.Date(2024, 12, 12, 15, 0, 0, 0, time.UTC)
+	report := "donations_by_student-2024-12-12.xlsx"
+
+	if _, err := Acquire(ctx, store, report, "timed out", now, 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := store.Read(ctx, LockPrefix+report+".lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both runs find the same stale lock
+	later := now.Add(time.Hour)
+	first, err := Acquire(ctx, store, report, "first", later, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("stale lock not taken over: %v", err)
+	}
+	if _, err := Acquire(ctx, staleStore{store, stale}, report, "second", later, 10*time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("stale lock taken over twice: got %v, want ErrLocked", err)
+	}
+
+	// The first run still holds the lock
+	if _, err := Acquire(ctx, store, report, "third", later.Add(time.Minute), 10*time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v, want ErrLocked", err)
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Read(ctx, LockPrefix+report+".lock"); !errors.Is(err, blob.ErrNotExist) {
+		t.Errorf("lock not released: %v", err)
+	}
+}
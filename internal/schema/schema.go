@@ -0,0 +1,291 @@
+// Package schema locates spreadsheet columns by their header names so
+// that readers don't depend on the position of a column in the sheet.
+// Donation platforms reorder and insert columns without notice; mapping
+// by header lets us notice a missing column before any money is assigned
+// to the wrong student.
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Column describes a single column we expect to find in a sheet.
+type Column struct {
+	// Field is the key readers use to look the column up.
+	Field string
+	// Aliases lists the header names accepted for this column.  The
+	// first alias is used when reporting a missing column.
+	Aliases []string
+	// Required columns must be present or Map fails.
+	Required bool
+	// Repeated columns may appear any number of times, numbered in
+	// their header, e.g. "Child 1 Name", "Child 2 Name".  A "#" in an
+	// alias stands for the number, written as digits or as an ordinal
+	// ("First Child Name").  An alias without "#" is column number 1.
+	Repeated bool
+}
+
+// Schema is the set of columns a reader knows how to use.
+type Schema struct {
+	Name    string
+	Columns []Column
+}
+
+// WithAliases returns a copy of the schema with extra header names
+// accepted for field.  The original schema is left untouched.
+func (s Schema) WithAliases(field string, aliases ...string) Schema {
+	columns := make([]Column, len(s.Columns))
+	for i, col := range s.Columns {
+		col.Aliases = append([]string(nil), col.Aliases...)
+		if col.Field == field {
+			col.Aliases = append(col.Aliases, aliases...)
+		}
+		columns[i] = col
+	}
+	s.Columns = columns
+	return s
+}
+
+// Mapping records the position of every known column found in a header row.
+type Mapping struct {
+	schema Schema
+	header []string
+	index  map[string]int
+	// repeats holds the position of each numbered column of a repeated
+	// field, keyed by the number in its header
+	repeats map[string]map[int]int
+}
+
+// MissingColumnsError is returned by Map when required columns are absent.
+type MissingColumnsError struct {
+	Schema  string
+	Sheet   string
+	Missing []string
+	Found   []string
+}
+
+func (e *MissingColumnsError) Error() string {
+	return fmt.Sprintf(
+		"%s sheet %q is missing required columns: %s (found: %s)",
+		e.Schema,
+		e.Sheet,
+		strings.Join(e.Missing, ", "),
+		strings.Join(e.Found, ", "),
+	)
+}
+
+// Map matches the header row of sheet against the schema.  Header names
+// are compared case-insensitively and ignoring extra whitespace.  All
+// missing required columns are reported together.
+func (s Schema) Map(sheet string, header []string) (*Mapping, error) {
+	positions := make(map[string]int)
+	for i, name := range header {
+		key := normalize(name)
+		if key == "" {
+			continue
+		}
+		// The first occurrence of a header wins
+		if _, ok := positions[key]; !ok {
+			positions[key] = i
+		}
+	}
+
+	m := &Mapping{
+		schema:  s,
+		header:  header,
+		index:   make(map[string]int),
+		repeats: make(map[string]map[int]int),
+	}
+	var missing []string
+
+	for _, col := range s.Columns {
+		var found bool
+		if col.Repeated {
+			m.repeats[col.Field] = mapRepeated(col, header)
+			found = len(m.repeats[col.Field]) > 0
+		} else {
+			for _, alias := range col.Aliases {
+				if i, ok := positions[normalize(alias)]; ok {
+					m.index[col.Field] = i
+					found = true
+					break
+				}
+			}
+		}
+		if !found && col.Required {
+			missing = append(missing, strings.ReplaceAll(col.Aliases[0], "#", "1"))
+		}
+	}
+
+	if len(missing) > 0 {
+		var found []string
+		for _, name := range header {
+			if strings.TrimSpace(name) != "" {
+				found = append(found, strings.TrimSpace(name))
+			}
+		}
+		return nil, &MissingColumnsError{
+			Schema:  s.Name,
+			Sheet:   sheet,
+			Missing: missing,
+			Found:   found,
+		}
+	}
+
+	return m, nil
+}
+
+// ordinals are the numbers accepted as words in repeated column headers.
+var ordinals = []string{"first", "second", "third", "fourth", "fifth", "sixth", "seventh", "eighth", "ninth", "tenth"}
+
+// mapRepeated finds every numbered column of a repeated field and
+// returns their positions keyed by number.  Numbers don't need to be
+// contiguous; the first header found for a number wins.
+func mapRepeated(col Column, header []string) map[int]int {
+	number := `(\d+|` + strings.Join(ordinals, "|") + `)`
+
+	var patterns []*regexp.Regexp
+	for _, alias := range col.Aliases {
+		parts := strings.Split(normalize(alias), "#")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		patterns = append(patterns, regexp.MustCompile("^"+strings.Join(parts, number)+"$"))
+	}
+
+	byNumber := make(map[int]int)
+	for i, name := range header {
+		key := normalize(name)
+		if key == "" {
+			continue
+		}
+		for _, re := range patterns {
+			match := re.FindStringSubmatch(key)
+			if match == nil {
+				continue
+			}
+			n := 1
+			if len(match) > 1 {
+				n = columnNumber(match[1])
+			}
+			if _, ok := byNumber[n]; !ok && n > 0 {
+				byNumber[n] = i
+			}
+			break
+		}
+	}
+
+	return byNumber
+}
+
+// columnNumber converts the number of a repeated column header, written
+// as digits or as an ordinal, to an int.
+func columnNumber(s string) int {
+	for i, word := range ordinals {
+		if s == word {
+			return i + 1
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Has reports whether the column for field was found in the header.
+func (m *Mapping) Has(field string) bool {
+	_, ok := m.index[field]
+	return ok || len(m.repeats[field]) > 0
+}
+
+// Value returns the trimmed cell for field in row.  Rows are often
+// shorter than the header because trailing empty cells are dropped, so
+// a missing cell is returned as an empty string.
+func (m *Mapping) Value(row []string, field string) string {
+	i, ok := m.index[field]
+	if !ok {
+		return ""
+	}
+	return cell(row, i)
+}
+
+// Numbers returns the numbers of the columns found for the repeated
+// field, in ascending order.
+func (m *Mapping) Numbers(field string) []int {
+	numbers := make([]int, 0, len(m.repeats[field]))
+	for n := range m.repeats[field] {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// RepeatedValue returns the trimmed cell of column number n of the
+// repeated field in row.
+func (m *Mapping) RepeatedValue(row []string, field string, n int) string {
+	i, ok := m.repeats[field][n]
+	if !ok {
+		return ""
+	}
+	return cell(row, i)
+}
+
+// Header returns the header name of the column for field as it appears
+// in the sheet, or the first alias of the column when it wasn't found.
+// For repeated fields the lowest numbered column is used.
+func (m *Mapping) Header(field string) string {
+	n := 1
+	if numbers := m.Numbers(field); len(numbers) > 0 {
+		n = numbers[0]
+	}
+	return m.RepeatedHeader(field, n)
+}
+
+// RepeatedHeader returns the header name of column number n of the
+// repeated field.
+func (m *Mapping) RepeatedHeader(field string, n int) string {
+	if i, ok := m.index[field]; ok {
+		return strings.TrimSpace(m.header[i])
+	}
+	if i, ok := m.repeats[field][n]; ok {
+		return strings.TrimSpace(m.header[i])
+	}
+	for _, col := range m.schema.Columns {
+		if col.Field == field && len(col.Aliases) > 0 {
+			return strings.ReplaceAll(col.Aliases[0], "#", strconv.Itoa(n))
+		}
+	}
+	return field
+}
+
+func cell(row []string, i int) string {
+	if i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+func normalize(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// RowError describes a problem with a single row of an input sheet.  Row
+// is the 1-based row number as shown by spreadsheet programs.
+type RowError struct {
+	Sheet  string
+	Row    int
+	Column string
+	Reason string
+}
+
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("sheet %q row %d: %s", e.Sheet, e.Row, e.Reason)
+	}
+	return fmt.Sprintf("sheet %q row %d, column %q: %s", e.Sheet, e.Row, e.Column, e.Reason)
+}
@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testSchema = Schema{
+	Name: "test",
+	Columns: []Column{
+		{Field: "name", Aliases: []string{"Donor Name", "Name"}, Required: true},
+		{Field: "amount", Aliases: []string{"Amount"}, Required: true},
+		{Field: "account", Aliases: []string{"Account Number"}},
+	},
+}
+
+func TestMap(t *testing.T) {
+	m, err := testSchema.Map("Data", []string{"Date", " amount ", "NAME"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	row := []string{"2024-12-01", "$10.00", "Jane Doe"}
+	if got := m.Value(row, "name"); got != "Jane Doe" {
+		t.Errorf("name: got %q, want %q", got, "Jane Doe")
+	}
+	if got := m.Value(row, "amount"); got != "$10.00" {
+		t.Errorf("amount: got %q, want %q", got, "$10.00")
+	}
+	if m.Has("account") {
+		t.Errorf("account should not be mapped")
+	}
+	if got := m.Value(row, "account"); got != "" {
+		t.Errorf("account: got %q, want empty", got)
+	}
+
+	// Short rows don't panic
+	if got := m.Value([]string{"2024-12-01"}, "name"); got != "" {
+		t.Errorf("short row: got %q, want empty", got)
+	}
+}
+
+func TestMapMissingColumns(t *testing.T) {
+	_, err := testSchema.Map("Data", []string{"Date", "Account Number"})
+
+	var missing *MissingColumnsError
+	if !errors.As(err, &missing) {
+		t.Fatalf("got %v, want MissingColumnsError", err)
+	}
+
+	want := []string{"Donor Name", "Amount"}
+	if !reflect.DeepEqual(missing.Missing, want) {
+		t.Errorf("got %v, want %v", missing.Missing, want)
+	}
+}
+
+func TestWithAliases(t *testing.T) {
+	s := testSchema.WithAliases("name", "Supporter")
+
+	if _, err := s.Map("Data", []string{"Supporter", "Amount"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := testSchema.Map("Data", []string{"Supporter", "Amount"}); err == nil {
+		t.Errorf("original schema should not accept the new alias")
+	}
+}
@@ -0,0 +1,239 @@
+// Package tabular reads the rows of the spreadsheets the report is made
+// from, whatever format they were exported in.  Donation platforms and
+// student information systems export Excel workbooks as well as CSV and
+// TSV text files in a variety of encodings; all of them are read into
+// the same rows so the readers of the ingest package don't need to know
+// where a file came from.
+package tabular
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	excelize "github.com/xuri/excelize/v2"
+)
+
+// ErrOldExcel is returned for workbooks saved in the Excel 97-2003
+// format, which can't be read.
+var ErrOldExcel = errors.New("Excel 97-2003 workbooks (.xls) can't be read, save the file as .xlsx or CSV")
+
+var (
+	zipMagic = []byte("PK\x03\x04")
+	oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+)
+
+// delimiters are the delimiters of text files, in order of preference.
+var delimiters = []rune{',', '\t', ';', '|'}
+
+// sampleLines is how many lines are looked at to find the delimiter.
+const sampleLines = 20
+
+// Rows reads every row of a file.  A workbook is read from the named
+// sheet; a text file holds a single table and sheet is ignored.  The
+// format, the encoding and the delimiter of a text file are detected
+// from its content, not from its name.
+func Rows(data []byte, sheet string) ([][]string, error) {
+	switch {
+	case bytes.HasPrefix(data, zipMagic):
+		return workbookRows(data, sheet)
+	case bytes.HasPrefix(data, oleMagic):
+		return nil, ErrOldExcel
+	}
+
+	text, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = delimiter(text)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			row[i] = strings.TrimSpace(cell)
+		}
+	}
+	return rows, nil
+}
+
+func workbookRows(data []byte, sheet string) ([][]string, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.GetRows(sheet)
+}
+
+// decode returns the text of a file as UTF-8.  UTF-8 and UTF-16 files
+// are recognized by their byte order mark; UTF-16 files without one by
+// their zero bytes.  Text that isn't valid UTF-8 is read as Windows-1252,
+// the encoding spreadsheet programs save CSV files in by default.
+func decode(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], false)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], true)
+	default:
+		if bigEndian, ok := looksUTF16(data); ok {
+			return decodeUTF16(data, bigEndian)
+		}
+	}
+
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	return decodeWindows1252(data), nil
+}
+
+// looksUTF16 reports whether data is UTF-16 text without a byte order
+// mark, which is mostly ASCII with a zero byte before or after each
+// character.
+func looksUTF16(data []byte) (bigEndian, ok bool) {
+	n := min(len(data), 512) &^ 1
+	if n == 0 {
+		return false, false
+	}
+	var even, odd int
+	for i := 0; i < n; i += 2 {
+		if data[i] == 0 {
+			even++
+		}
+		if data[i+1] == 0 {
+			odd++
+		}
+	}
+	half := n / 4
+	switch {
+	case even > half && odd == 0:
+		return true, true
+	case odd > half && even == 0:
+		return false, true
+	}
+	return false, false
+}
+
+func decodeUTF16(data []byte, bigEndian bool) (string, error) {
+	if len(data)%2 != 0 {
+		return "", fmt.Errorf("UTF-16 text has an odd number of bytes")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252; the other
+// bytes are the same as in Latin-1.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+func decodeWindows1252(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data))
+	for _, c := range data {
+		switch {
+		case c >= 0x80 && c < 0xA0:
+			b.WriteRune(windows1252[c-0x80])
+		default:
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// delimiter guesses the delimiter of a text table from its first lines.
+// The delimiter found the same number of times on every line wins, the
+// one found most often on the header if several are; a comma is assumed
+// when no delimiter is found.  Delimiters inside quotes are not counted,
+// so amounts like "$1,000.00" don't hide a tab delimiter.
+func delimiter(text string) rune {
+	lines := countDelimiters(text)
+	if len(lines) == 0 {
+		return ','
+	}
+
+	best, bestConsistent, bestCount := ',', false, 0
+	for i, d := range delimiters {
+		count := lines[0][i]
+		if count == 0 {
+			continue
+		}
+		consistent := true
+		for _, line := range lines[1:] {
+			if line[i] != count {
+				consistent = false
+				break
+			}
+		}
+		if (consistent && !bestConsistent) || (consistent == bestConsistent && count > bestCount) {
+			best, bestConsistent, bestCount = d, consistent, count
+		}
+	}
+	return best
+}
+
+// countDelimiters counts each delimiter outside quotes on the first
+// non-blank lines of text.
+func countDelimiters(text string) [][]int {
+	var lines [][]int
+	counts := make([]int, len(delimiters))
+	blank, quoted := true, false
+
+	endLine := func() {
+		if !blank {
+			lines = append(lines, counts)
+		}
+		counts = make([]int, len(delimiters))
+		blank = true
+	}
+
+	for _, r := range text {
+		if len(lines) == sampleLines {
+			break
+		}
+		switch {
+		case r == '"':
+			quoted = !quoted
+			blank = false
+		case quoted:
+		case r == '\n':
+			endLine()
+		case r == '\r':
+		default:
+			blank = false
+			for i, d := range delimiters {
+				if r == d {
+					counts[i]++
+				}
+			}
+		}
+	}
+	if len(lines) < sampleLines {
+		endLine()
+	}
+
+	return lines
+}
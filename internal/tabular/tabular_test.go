@@ -0,0 +1,76 @@
+package tabular
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/jotacamou/datacor/internal/xlsxtest"
+)
+
+func TestRows(t *testing.T) {
+	want := [][]string{
+		{"Date", "Donor Name", "Amount", "Student Name"},
+		{"12/01/2024", "José Núñez", "$1,000.00", "Sam Doe"},
+	}
+
+	utf16le := func(s string, bom bool) []byte {
+		var data []byte
+		if bom {
+			data = append(data, 0xFF, 0xFE)
+		}
+		for _, u := range utf16.Encode([]rune(s)) {
+			data = append(data, byte(u), byte(u>>8))
+		}
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"xlsx", xlsxtest.Workbook(t, [][]interface{}{
+			{"Date", "Donor Name", "Amount", "Student Name"},
+			{"12/01/2024", "José Núñez", "$1,000.00", "Sam Doe"},
+		})},
+		{"csv", []byte("Date,Donor Name,Amount,Student Name\n12/01/2024,José Núñez,\"$1,000.00\",Sam Doe\n")},
+		{"csv with BOM and CRLF", []byte("\xEF\xBB\xBFDate,Donor Name,Amount,Student Name\r\n12/01/2024, José Núñez ,\"$1,000.00\",Sam Doe\r\n")},
+		{"tsv", []byte("Date\tDonor Name\tAmount\tStudent Name\n12/01/2024\tJosé Núñez\t$1,000.00\tSam Doe\n")},
+		{"UTF-16 tsv", utf16le("Date\tDonor Name\tAmount\tStudent Name\r\n12/01/2024\tJosé Núñez\t$1,000.00\tSam Doe\r\n", true)},
+		{"UTF-16 without BOM", utf16le("Date,Donor Name,Amount,Student Name\n12/01/2024,José Núñez,\"$1,000.00\",Sam Doe\n", false)},
+		{"Windows-1252 semicolons", []byte("Date;Donor Name;Amount;Student Name\n12/01/2024;Jos\xE9 N\xFA\xF1ez;$1,000.00;Sam Doe\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := Rows(tt.data, "Data")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(rows, want) {
+				t.Errorf("got %q, want %q", rows, want)
+			}
+		})
+	}
+}
+
+func TestRowsQuotedLines(t *testing.T) {
+	data := []byte("Donor Name,Note\n\"Doe, Jane\",\"Thanks\nagain\"\n")
+
+	rows, err := Rows(data, "Data")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]string{{"Donor Name", "Note"}, {"Doe, Jane", "Thanks\nagain"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %q, want %q", rows, want)
+	}
+}
+
+func TestRowsOldExcel(t *testing.T) {
+	data := []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1, 0, 0}
+	if _, err := Rows(data, "Data"); !errors.Is(err, ErrOldExcel) {
+		t.Errorf("got error %v, want ErrOldExcel", err)
+	}
+}
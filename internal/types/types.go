@@ -1,5 +1,12 @@
 package types
 
+import (
+	"strings"
+	"time"
+
+	"github.com/jotacamou/datacor/internal/money"
+)
+
 type Parent struct {
 	Name          string
 	Children      []Student
@@ -7,34 +14,142 @@ type Parent struct {
 }
 
 type Student struct {
-	Name                        string
-	Grade                       string
-	Class                       string
-	Parent1                     string
-	Parent2                     string
-	Parent3                     string
-	PrimaryDonor1               string
-	PrimaryDonor2               string
-	PrimaryDonor3               string
-	PrimaryDonorsPerStudent     int
-	PrimaryDonor1DonationAmount float64
-	PrimaryDonor2DonationAmount float64
-	PrimaryDonor3DonationAmount float64
-	TotalDonationAmount         float64
-}
-
-// type AllStudents map[string]Student
+	ID    string // student ID from the roster, if any
+	Name  string
+	Grade string
+	Class string
+	// Parents lists the care givers of the student from the roster
+	Parents []string
+	// Accounts lists the account numbers of the student's families
+	Accounts []string
+	// PrimaryDonors lists everyone who gave for the student, in the
+	// order of their first gift
+	PrimaryDonors       []Donor
+	TotalDonationAmount money.Cents
+	// CareGiverAmount and OtherAmount split the total between gifts from
+	// the student's care givers and gifts from everyone else
+	CareGiverAmount money.Cents
+	OtherAmount     money.Cents
+	// Gifts holds the share of each gift credited to the student, net
+	// of its refunds
+	Gifts map[*DonationTransaction]money.Cents
+	// Excluded students, such as those of scholarship families, are left
+	// out of the participation rates and the outreach list
+	Excluded bool
+	// Campaigns splits the total by the campaign of the gifts; gifts
+	// without a campaign are under ""
+	Campaigns map[string]money.Cents
+}
+
+// Donor is a primary donor of a student and the amount they gave for
+// that student.
+type Donor struct {
+	Name   string
+	Amount money.Cents
+	Kind   DonorKind
+	// Account is the donor's account number, if known.  Gifts from the
+	// same account are counted as one donor whatever the name on them.
+	Account string
+}
+
+// DonorKind classifies a donation by who gave it.
+type DonorKind string
+
+const (
+	// CareGiverDonor gifts come from a care giver of the student on the
+	// roster, by name or by family account
+	CareGiverDonor DonorKind = "Care Giver"
+	// OtherDonor gifts come from extended family and friends
+	OtherDonor DonorKind = "Family & Friends"
+	// Unattributed gifts couldn't be assigned to any student
+	Unattributed DonorKind = "Unattributed"
+)
+
+// Key returns the key identifying the student in AllStudents.
+func (s Student) Key() string {
+	return StudentKey(s.ID, s.Name, s.Class)
+}
+
+// StudentKey builds the key identifying a student: the roster student ID
+// when there is one, otherwise the name and class, so that two students
+// with the same name in different classes are kept apart.
+func StudentKey(id, name, class string) string {
+	if id = normalizeKey(id); id != "" {
+		return "id:" + id
+	}
+	return "name:" + normalizeKey(name) + "|" + normalizeKey(class)
+}
+
+func normalizeKey(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// AllStudents holds every student of the roster keyed by Student.Key.
+type AllStudents map[string]Student
+
 type DonationTransaction struct {
-	Date               string
-	Name               string
-	Amount             string
-	FirstStudentName   string
-	FirstStudentClass  string
-	SecondStudentName  string
-	SecondStudentClass string
-	ThirdStudentName   string
-	ThirdStudentClass  string
-	AccountNumber      string
+	Row    int // row of the transaction in the source sheet
+	Date   string
+	Name   string
+	Amount money.Cents
+	// Students lists the students named on the transaction
+	Students      []StudentRef
+	AccountNumber string
+	// Campaign is the campaign or fund the gift was given to, from the
+	// export or from the campaign rules
+	Campaign string
+	Memo     string
+	// ID is the donation platform's ID of the transaction, when the
+	// export has one
+	ID string
+}
+
+// StudentRef is a student as named on a donation transaction.
+type StudentRef struct {
+	ID    string
+	Name  string
+	Class string
+	// Amount is the part of the gift the donor meant for this student,
+	// when the donation platform records one; zero otherwise
+	Amount money.Cents
+}
+
+// StudentNames returns the names of the students the transaction is for.
+func (t *DonationTransaction) StudentNames() []string {
+	names := []string{}
+	for _, student := range t.Students {
+		if student.Name != "" {
+			names = append(names, student.Name)
+		}
+	}
+	return names
+}
+
+// AliasKind tells what an alias corrects on the donation transactions.
+type AliasKind string
+
+const (
+	DonorAlias   AliasKind = "Donor"
+	AccountAlias AliasKind = "Account"
+	StudentAlias AliasKind = "Student"
+)
+
+// Alias is a manual correction kept by the office so that a misspelled
+// donor or student name, or an account number, is fixed the same way on
+// every run.
+type Alias struct {
+	Row  int // row of the alias in the source sheet
+	Kind AliasKind
+	// From is the donor name, account number or student name as it
+	// appears on the transactions
+	From string
+	// FromClass, when set, limits a student alias to that class
+	FromClass string
+	// DonorName is the name the donor is reported under
+	DonorName string
+	// Student is the roster student meant
+	Student StudentRef
+	Note    string
 }
 
 // StorageObjectData contains metadata of the Cloud Storage object.
@@ -42,3 +157,35 @@ type StorageObjectData struct {
 	Bucket string `json:"bucket,omitempty"`
 	Name   string `json:"name,omitempty"`
 }
+
+// Exclusion leaves a family or a student out of the participation rates,
+// e.g. a scholarship family.  A family is named by its account number or
+// by a care giver; a student by name, optionally with a class, or by ID.
+type Exclusion struct {
+	Row       int // row of the exclusion in the source sheet
+	Account   string
+	CareGiver string
+	Student   StudentRef
+	Reason    string
+}
+
+// Goal is a fundraising target of a campaign for a class, a grade or,
+// when it names neither, the whole school.
+type Goal struct {
+	Row      int // row of the goal in the source sheet
+	Campaign string
+	Class    string
+	Grade    string
+	Amount   money.Cents
+}
+
+// CampaignRule tags the gifts that don't say what campaign they were
+// given to: gifts dated from From to To, both included, whose memo
+// contains Keyword.  A zero date or an empty keyword matches any gift.
+type CampaignRule struct {
+	Row      int // row of the rule in the source sheet
+	Campaign string
+	From     time.Time
+	To       time.Time
+	Keyword  string
+}
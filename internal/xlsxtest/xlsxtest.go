@@ -0,0 +1,33 @@
+// Package xlsxtest builds small spreadsheets for tests.
+package xlsxtest
+
+import (
+	"bytes"
+	"testing"
+
+	excelize "github.com/xuri/excelize/v2"
+)
+
+// Workbook returns an xlsx file with rows on its "Data" sheet.
+func Workbook(t testing.TB, rows [][]interface{}) []byte {
+	t.Helper()
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName("Sheet1", "Data"); err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow("Data", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
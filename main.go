@@ -38,72 +38,54 @@
 package donationsbystudent
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"regexp"
+	"os"
+	"path"
 	"strconv"
 	"strings"
-	"unicode/utf8"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 	"github.com/cloudevents/sdk-go/v2/event"
-	"github.com/jotacamou/datacor/internal/misc"
-	excelize "github.com/xuri/excelize/v2"
+	"github.com/jotacamou/datacor/internal/alloc"
+	"github.com/jotacamou/datacor/internal/archive"
+	"github.com/jotacamou/datacor/internal/blob"
+	"github.com/jotacamou/datacor/internal/config"
+	"github.com/jotacamou/datacor/internal/history"
+	"github.com/jotacamou/datacor/internal/report"
+	"github.com/jotacamou/datacor/internal/runs"
 )
 
-type Parent struct {
-	Name          string
-	Children      []Student
-	AccountNumber string
-}
-
-type Student struct {
-	Name                        string
-	Grade                       string
-	Class                       string
-	Parent1                     string
-	Parent2                     string
-	Parent3                     string
-	PrimaryDonor1               string
-	PrimaryDonor2               string
-	PrimaryDonor3               string
-	PrimaryDonorsPerStudent     int
-	PrimaryDonor1DonationAmount float64
-	PrimaryDonor2DonationAmount float64
-	PrimaryDonor3DonationAmount float64
-	TotalDonationAmount         float64
-}
-
-type AllStudents map[string]Student
-
-type DonationTransation struct {
-	Date               string
-	Name               string
-	Amount             string
-	FirstStudentName   string
-	FirstStudentClass  string
-	SecondStudentName  string
-	SecondStudentClass string
-	ThirdStudentName   string
-	ThirdStudentClass  string
-	AccountNumber      string
-}
-
 // StorageObjectData contains metadata of the Cloud Storage object.
 type StorageObjectData struct {
 	Bucket string `json:"bucket,omitempty"`
 	Name   string `json:"name,omitempty"`
+	// Generation changes every time the object is written; Cloud
+	// Storage sends it as a string
+	Generation string `json:"generation,omitempty"`
+	MD5Hash    string `json:"md5Hash,omitempty"`
 }
 
-// Global variables populated by generateDonationsByStudentReport
-var (
-	bucket     string = ""
-	txnsFile   string = ""
-	outputFile string = ""
-)
+// upload is the state of a run for the object that triggered it.
+type upload struct {
+	// store holds the input and output files, the bucket that triggered
+	// the function
+	store      blob.Store
+	txnsFile   string
+	outputFile string
+	// profile configures the reports of the upload
+	profile *config.Profile
+	// runKey identifies the version of the upload in the run ledger
+	runKey string
+}
+
+// lockTTL is how long a report lock is held before it's taken to be left
+// by a run that died.  It's longer than the longest function timeout.
+const lockTTL = 10 * time.Minute
 
 func init() {
 	functions.CloudEvent("GenerateDonationsByStudentReport", generateDonationsByStudentReport)
@@ -117,655 +99,367 @@ func generateDonationsByStudentReport(ctx context.Context, e event.Event) error
 		return fmt.Errorf("event.DataAs: %v", err)
 	}
 
-	bucket = data.Bucket
-	txnsFile = data.Name
+	u := &upload{txnsFile: data.Name}
+
+	// Files the function keeps for itself trigger it too
+	if isInternal(u.txnsFile) {
+		return nil
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	u.store = blob.NewGCS(client, data.Bucket)
 
-	// The object name triggering the function should match
-	// this format: 2024-12-12-Report.xlsx
-	pattern := `^\d{4}-\d{2}-\d{2}-Report\.xlsx$`
-	re, err := regexp.Compile(pattern)
+	// The configuration is read every run so that changing it doesn't
+	// need a deploy.  A broken one won't fix itself by retrying.
+	cfg, err := config.Load(ctx, u.store)
+	if errors.Is(err, config.ErrInvalid) {
+		logError(err)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	if !re.MatchString(txnsFile) {
-		return fmt.Errorf("Stopping execution, don't know what to do with object %s", txnsFile)
+	// Other objects, including the reports this function writes to the
+	// bucket, are ignored rather than failed so that they aren't retried.
+	var ok bool
+	u.profile, ok = cfg.Find(u.txnsFile)
+	if !ok {
+		fmt.Printf("Stopping execution, object %s doesn't match any input pattern\n", u.txnsFile)
+		return nil
 	}
 
-	reportDate := strings.Split(txnsFile, "-")
-	outputFile = fmt.Sprintf(
-		"donations_by_student-%s-%s-%s.xlsx",
-		reportDate[0],
-		reportDate[1],
-		reportDate[2],
-	)
+	u.outputFile = u.profile.OutputName(u.txnsFile, time.Now())
 
-	run()
+	generation, _ := strconv.ParseInt(data.Generation, 10, 64)
+	u.runKey = runs.Key(generation, data.MD5Hash)
 
-	return nil
+	return u.process(ctx, e)
 }
 
-func run() {
-	f := excelize.NewFile()
-	defer func() {
-		if err := f.Close(); err != nil {
-			fmt.Println(err)
+// isInternal reports whether the object is one the function writes for
+// its own bookkeeping.
+func isInternal(name string) bool {
+	for _, prefix := range []string{archive.Prefix, runs.LedgerPrefix, runs.LockPrefix, path.Dir(history.File) + "/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
 		}
-	}()
-
-	sheetName := "Donations By Student"
-	i, err := f.NewSheet(sheetName)
-	if err != nil {
-		fmt.Println(err)
-		return
 	}
+	return strings.HasSuffix(name, ".error.json") || name == config.File
+}
 
-	f.SetActiveSheet(i)
-
-	err = f.DeleteSheet("Sheet1")
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	donationsByStudentHeader := []interface{}{
-		"Student",
-		"Class",
-		"Care Giver 1",
-		"Care Giver 2",
-		"Care Giver 3",
-		"Primary Donor 1",
-		"Primary Donor 2",
-		"Primary Donor 3",
-		"Primary Donors Per Student",
-		"Primary Donor 1 Donation Amount",
-		"Primary Donor 2 Donation Amount",
-		"Primary Donor 3 Donation Amount",
-		"Total Donation Amount",
-	}
-
-	style, err := f.NewStyle(&excelize.Style{
-		Font: &excelize.Font{
-			Size:   10,
-			Family: "Calibri",
-		},
-	})
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	// Determine the desired range of cells to format.
-	// For instance, you might typically use only up to Z (column 26) and 100 rows.
-	maxColumns := 26
-	maxRows := 300
-
-	for col := 1; col <= maxColumns; col++ {
-		// colName, _ := excelize.ColumnNumberToName(col)
-		for row := 1; row <= maxRows; row++ {
-			cell, _ := excelize.CoordinatesToCellName(col, row)
-			if err := f.SetCellStyle(sheetName, cell, cell, style); err != nil {
-				fmt.Println(err)
-				return
-			}
+// process runs the report for the upload and decides what becomes of a
+// failure.
+func (u *upload) process(ctx context.Context, e event.Event) error {
+	err := u.run(ctx)
+	if err == nil {
+		// A report was written, so an earlier failure no longer applies
+		if err := u.store.Delete(ctx, failureMarker(u.txnsFile)); err != nil && !errors.Is(err, blob.ErrNotExist) {
+			fmt.Println(err)
 		}
+		return nil
 	}
 
-	dollarAmountStyle, err := f.NewStyle(&excelize.Style{
-		NumFmt: 165,
-	})
-	if err != nil {
+	// Let the office know why no report appeared
+	if err := u.writeFailureMarker(ctx, e, err); err != nil {
 		fmt.Println(err)
-		return
 	}
 
-	err = f.SetColStyle(sheetName, "J:M", dollarAmountStyle)
-	if err != nil {
-		fmt.Println(err)
-		return
+	// Retryable failures are returned so that Cloud Functions runs the
+	// upload again.  Retrying won't fix a bad upload, so those are only
+	// logged as errors.
+	if report.IsRetryable(err) {
+		return err
 	}
+	logError(err)
+	return nil
+}
 
-	err = f.SetCellValue(sheetName, "A1", "Last Updated:")
+func (u *upload) run(ctx context.Context) error {
+	// How gifts for several siblings are shared is chosen per run
+	policy, err := alloc.ParsePolicy(os.Getenv("SPLIT_POLICY"))
 	if err != nil {
-		fmt.Println(err)
+		return &report.Error{Stage: "read configuration", File: "SPLIT_POLICY", Err: err}
 	}
 
-	// Create a new style with a yellow background.
-	dateStyle, err := f.NewStyle(&excelize.Style{
-		Fill: excelize.Fill{
-			Type:    "pattern",
-			Color:   []string{"#FFFF00"}, // Yellow color in HEX format
-			Pattern: 1,
-		},
-	})
+	// Archived runs are kept forever unless a retention is set
+	retention, err := retentionFromEnv()
 	if err != nil {
-		fmt.Println(err)
+		return &report.Error{Stage: "read configuration", File: "ARCHIVE_RETENTION_DAYS", Err: err}
 	}
 
-	err = f.SetCellStyle(sheetName, "B1", "B1", dateStyle)
+	// The report covers the donation history from this date when set
+	from, err := historyFromEnv()
 	if err != nil {
-		fmt.Println(err)
+		return &report.Error{Stage: "read configuration", File: "HISTORY_FROM", Err: err}
 	}
 
-	err = f.SetSheetRow(sheetName, "A2", &donationsByStudentHeader)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	err = f.SetCellValue(sheetName, "B1", misc.DateFromFileName(txnsFile))
+	// Cloud Storage may deliver the same event more than once
+	ledger := runs.NewLedger(u.store)
+	done, err := ledger.Done(ctx, u.txnsFile, u.runKey)
 	if err != nil {
-		fmt.Println(err)
+		return &report.Error{Stage: "read run ledger", File: u.txnsFile, Err: err, Retryable: true}
 	}
-
-	if err := f.SetColWidth(sheetName, "A", "A", 20); err != nil {
-		fmt.Println(err)
+	if done {
+		fmt.Printf("Upload %s (%s) was already processed, skipping\n", u.txnsFile, u.runKey)
+		return nil
 	}
 
-	students, err := makeStudentRows()
+	// Uploads for the same date write the same report, one at a time
+	lock, err := runs.Acquire(ctx, u.store, u.outputFile, u.txnsFile+" "+u.runKey, time.Now(), lockTTL)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return &report.Error{Stage: "lock report", File: u.outputFile, Err: err, Retryable: true}
 	}
-
-	donations, err := readTransactions()
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	assignDonationsToStudents(students, donations)
-
-	// data contains the rows to be written to the worksheet.
-	// This slice of interface slices is what the excelize
-	// library expects to write to the worksheet.
-	var data [][]interface{}
-
-	for _, student := range students {
-		data = append(data, []interface{}{
-			student.Name,
-			student.Class,
-			student.Parent1,
-			student.Parent2,
-			student.Parent3,
-			student.PrimaryDonor1,
-			student.PrimaryDonor2,
-			student.PrimaryDonor3,
-			student.PrimaryDonorsPerStudent,
-			student.PrimaryDonor1DonationAmount,
-			student.PrimaryDonor2DonationAmount,
-			student.PrimaryDonor3DonationAmount,
-			student.TotalDonationAmount,
-		})
-	}
-
-	for i := 3; i < (len(data) + 3); i++ {
-		err := f.SetSheetRow(sheetName, fmt.Sprintf("A%d", i), &data[i-3])
-		if err != nil {
-			fmt.Println(err)
+	defer func() {
+		if err := lock.Release(ctx); err != nil {
+			fmt.Printf("Failed to release the lock of %s: %v\n", u.outputFile, err)
 		}
-	}
+	}()
 
-	// Resize cells to accomodate value lenghts
-	err = xlsAdjustColumnsWidth(f, sheetName)
+	// A repeated event may have waited for the lock while the first one
+	// finished the run
+	done, err = ledger.Done(ctx, u.txnsFile, u.runKey)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return &report.Error{Stage: "read run ledger", File: u.txnsFile, Err: err, Retryable: true}
 	}
-
-	// Write non care giver donations to the worksheet (separate sheet)
-	nonCareGiverDonationsSheetName := "Non Care Giver Donations"
-
-	i, err = f.NewSheet(nonCareGiverDonationsSheetName)
-	if err != nil {
-		fmt.Println(err)
-		return
+	if done {
+		fmt.Printf("Upload %s (%s) was already processed, skipping\n", u.txnsFile, u.runKey)
+		return nil
 	}
 
-	f.SetActiveSheet(i)
-
-	nonCareGiverDonationsHeader := []interface{}{
-		"Date",
-		"Name",
-		"Amount",
+	// Every export is added to the donation history.  It's only needed
+	// for this report when the report covers the history.
+	records, err := u.updateHistory(ctx)
+	if err != nil && !from.IsZero() {
+		return err
 	}
-
-	err = f.SetSheetRow(nonCareGiverDonationsSheetName, "A1", &nonCareGiverDonationsHeader)
 	if err != nil {
-		fmt.Println(err)
-		return
+		logWarning(fmt.Errorf("donations of %s not added to the history: %w", u.txnsFile, err))
 	}
 
-	nonCareGiverDonations, err := readTransactionsByNonCareGivers()
-	if err != nil {
-		fmt.Println(err)
-		return
+	inputs := report.Inputs{
+		Store:        u.store,
+		Transactions: u.txnsFile,
+		Roster:       u.profile.Roster,
+		Aliases:      u.profile.Aliases,
+		Exclusions:   u.profile.Exclusions,
+		Goals:        u.profile.Goals,
+		Campaigns:    u.profile.Campaigns,
 	}
+	var previousDate string
 
-	var nonCareGiverDonationsData [][]interface{}
-
-	for _, donation := range nonCareGiverDonations {
-		nonCareGiverDonationsData = append(nonCareGiverDonationsData, []interface{}{
-			donation.Date,
-			donation.Name,
-			donation.Amount,
-		})
+	if !from.IsZero() {
+		uploaded, _ := u.profile.Date(u.txnsFile)
+		inputs.Donations = history.Select(records, from, report.HistoryEnd(time.Time{}, uploaded, time.Now()))
+	} else {
+		// The last report of the same u.profile is compared with this one
+		inputs.Previous, previousDate = u.previousUpload(ctx)
 	}
 
-	for i := 2; i < (len(nonCareGiverDonationsData) + 2); i++ {
-		err := f.SetSheetRow(
-			nonCareGiverDonationsSheetName,
-			fmt.Sprintf("A%d", i),
-			&nonCareGiverDonationsData[i-2],
-		)
-		if err != nil {
-			fmt.Println(err)
-		}
-	}
-
-	// Resize cells to accomodate value lenghts
-	err = xlsAdjustColumnsWidth(f, nonCareGiverDonationsSheetName)
+	err = report.Generate(ctx, inputs, report.Options{
+		Output:       u.outputFile,
+		ReportDate:   u.profile.ReportDate(u.txnsFile),
+		PreviousDate: previousDate,
+		Policy:       policy,
+		Campaign:     u.profile.Name,
+	})
 	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	if err = writeBucketObject(bucket, outputFile, f); err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	fmt.Printf("Donations by student report saved to %s\n", outputFile)
-
-	// Clean up: delete the transaction file
-	if err := deleteBucketObject(bucket, txnsFile); err != nil {
-		fmt.Printf("Failed to delete transaction file %s: %v", txnsFile, err)
-	}
-}
-
-// writeBucketObject writes a file to a Google Cloud Storage bucket
-func writeBucketObject(bucketName, objectName string, f *excelize.File) error {
-	var buf bytes.Buffer
-	if err := f.Write(&buf); err != nil {
-		// fmt.Printf("Failed to write file to buffer: %v", err)
 		return err
 	}
 
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return err
+	// The upload is only archived once the report is confirmed written,
+	// so a failed run keeps its upload where it was
+	if _, err := u.store.Read(ctx, u.outputFile); err != nil {
+		return &report.Error{Stage: "confirm report", File: u.outputFile, Err: err, Retryable: true}
 	}
 
-	w := client.Bucket(bucketName).Object(objectName).NewWriter(ctx)
-	w.ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
-
-	defer w.Close()
+	fmt.Printf("Donations by student report saved to %s\n", u.outputFile)
 
-	if _, err := buf.WriteTo(w); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// deleteBucketObject deletes a file from a Google Cloud Storage bucket
-func deleteBucketObject(bucketName, objectName string) error {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+	// Recorded before the upload is archived away, so that a repeated
+	// event finds the run rather than a missing upload
+	err = ledger.Record(ctx, runs.Entry{
+		Upload:   u.txnsFile,
+		Key:      u.runKey,
+		Output:   u.outputFile,
+		Finished: time.Now().UTC(),
+	})
 	if err != nil {
-		return err
+		logWarning(fmt.Errorf("report %s written but not recorded as processed: %w", u.outputFile, err))
 	}
 
-	if err := client.Bucket(bucketName).Object(objectName).Delete(ctx); err != nil {
-		return err
+	// The report is out, so failing to archive must not run it again
+	// under a new run ID.  The upload is then kept for the next run.
+	if err := u.archiveRun(ctx, policy, retention); err != nil {
+		logWarning(fmt.Errorf("report %s written but its inputs were not archived: %w", u.outputFile, err))
 	}
 
 	return nil
 }
 
-// Auto adjust column width based on the content
-func xlsAdjustColumnsWidth(f *excelize.File, sheet string) error {
-	cols, err := f.GetCols(sheet)
+// updateHistory adds the donations of the upload to the donation history
+// and returns the history.  Uploads of any date may update it at the
+// same time, so it has a lock of its own.
+func (u *upload) updateHistory(ctx context.Context) ([]history.Record, error) {
+	lock, err := runs.Acquire(ctx, u.store, history.File, u.txnsFile+" "+u.runKey, time.Now(), lockTTL)
 	if err != nil {
-		return err
-	}
-
-	for idx, col := range cols {
-		largestWidth := 0
-		for _, rowCell := range col {
-			cellWidth := utf8.RuneCountInString(rowCell)
-			// cellWidth := utf8.RuneCountInString(rowCell) + 2
-			if cellWidth > largestWidth {
-				largestWidth = cellWidth
-			}
-		}
-		name, err := excelize.ColumnNumberToName(idx + 1)
-		if err != nil {
-			return err
-		}
-
-		err = f.SetColWidth(sheet, name, name, float64(largestWidth))
-		if err != nil {
-			return err
-		}
+		return nil, &report.Error{Stage: "lock history", File: history.File, Err: err, Retryable: true}
 	}
-
-	return nil
-}
-
-// assignDonationsToStudents distributes the donation amounts to the respective students based on the donation transactions
-func assignDonationsToStudents(students AllStudents, donations []*DonationTransation) {
-	for _, txn := range donations {
-		siblings := []string{txn.FirstStudentName, txn.SecondStudentName, txn.ThirdStudentName}
-		validSiblings := []string{}
-		for _, sibling := range siblings {
-			if sibling != "" {
-				validSiblings = append(validSiblings, sibling)
-			}
-		}
-
-		// Skip if there are no valid siblings.  We'll have to deal with this separately
-		if len(validSiblings) == 0 {
-			continue
-		}
-
-		donationPerStudent := parseDollarAmount(txn.Amount) / float64(len(validSiblings))
-
-		// fmt.Println("Donation per student:", donationPerStudent, txn.Amount, float64(len(validSiblings)))
-
-		// Update each student's donation information
-		for _, sibling := range validSiblings {
-			student, exists := students[sibling]
-			if !exists {
-				fmt.Println("Student does not exist:", sibling)
-				continue // Skip if the student does not exist
-			}
-
-			// Update the total donation amount
-			student.TotalDonationAmount += donationPerStudent
-
-			// Update the primary donors and their donation amounts
-			switch {
-			case student.PrimaryDonor1 == txn.Name:
-				student.PrimaryDonor1DonationAmount += donationPerStudent
-			case student.PrimaryDonor2 == txn.Name:
-				student.PrimaryDonor2DonationAmount += donationPerStudent
-			case student.PrimaryDonor3 == txn.Name:
-				student.PrimaryDonor3DonationAmount += donationPerStudent
-			case student.PrimaryDonor1 == "":
-				student.PrimaryDonor1 = txn.Name
-				student.PrimaryDonor1DonationAmount = donationPerStudent
-			case student.PrimaryDonor2 == "":
-				student.PrimaryDonor2 = txn.Name
-				student.PrimaryDonor2DonationAmount = donationPerStudent
-			case student.PrimaryDonor3 == "":
-				student.PrimaryDonor3 = txn.Name
-				student.PrimaryDonor3DonationAmount = donationPerStudent
-			}
-
-			// Update the number of primary donors
-			student.PrimaryDonorsPerStudent = 0
-			if student.PrimaryDonor1 != "" {
-				student.PrimaryDonorsPerStudent++
-			}
-			if student.PrimaryDonor2 != "" {
-				student.PrimaryDonorsPerStudent++
-			}
-			if student.PrimaryDonor3 != "" {
-				student.PrimaryDonorsPerStudent++
-			}
-
-			// Save the updated student back to the map
-			students[sibling] = student
+	defer func() {
+		if err := lock.Release(ctx); err != nil {
+			fmt.Printf("Failed to release the lock of %s: %v\n", history.File, err)
 		}
+	}()
 
-	}
-}
-
-// parseDollarAmount takes a string formatted as a dollar amount (e.g., "$10.00")
-// and converts it to a float64.
-func parseDollarAmount(amount string) float64 {
-	// Remove the dollar sign from the start of the string
-	cleanedAmount := strings.TrimPrefix(amount, "$")
-	// Convert the string to a float64
-	value, err := strconv.ParseFloat(cleanedAmount, 64)
-	if err != nil {
-		fmt.Println("Error parsing dollar amount:", err)
-		return 0
-	}
-	return value
+	return report.UpdateHistory(ctx, u.store, u.txnsFile, time.Now())
 }
 
-func makeStudentRows() (map[string]Student, error) {
-	parents, err := getParents()
+// previousUpload returns the archived upload of the last report of the
+// u.profile dated before this one, and its date.  Listing the changes is
+// an extra, so failing to find it is only logged.
+func (u *upload) previousUpload(ctx context.Context) (string, string) {
+	prefix := u.profile.OutputFolder + u.profile.OutputPrefix
+	m, err := archive.Latest(ctx, u.store, func(m *archive.Manifest) bool {
+		return strings.HasPrefix(m.Output, prefix) && m.Output < u.outputFile
+	})
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		fmt.Printf("Failed to find the previous report: %v\n", err)
+		return "", ""
 	}
-
-	students := make(AllStudents)
-
-	for _, parent := range parents {
-		for _, child := range parent.Children {
-			if existingChild, ok := students[child.Name]; ok {
-				addParent(&existingChild, parent.Name)
-				students[child.Name] = existingChild
-			} else {
-				addParent(&child, parent.Name)
-				students[child.Name] = child
-			}
-		}
+	if m == nil {
+		return "", ""
 	}
 
-	return students, nil
+	previous := m.Upload()
+	return previous.Archived, u.profile.ReportDate(previous.Name)
 }
 
-func addParent(student *Student, parentName string) {
-	parents := []*string{
-		&student.Parent1,
-		&student.Parent2,
-		&student.Parent3,
-	}
-	for _, parent := range parents {
-		if *parent == "" {
-			*parent = parentName
-			break
-		}
-	}
-}
-
-// getFileFromBucket reads a file from a Google Cloud Storage bucket
-// and returns the file as a byte slice.  The bucket name and file
-// name are passed as arguments.
-func getFileFromBucket(bucketName, fileName string) (*bytes.Reader, error) {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	rc, err := client.Bucket(bucketName).Object(fileName).NewReader(ctx)
+// archiveRun archives the exact inputs of the report, then cleans up the
+// upload and the runs past the retention.
+func (u *upload) archiveRun(ctx context.Context, policy alloc.Policy, retention time.Duration) error {
+	data, err := u.store.Read(ctx, u.txnsFile)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	blob, err := io.ReadAll(rc)
-	rc.Close()
+	now := time.Now()
+	manifest, err := archive.Save(ctx, u.store, archive.Manifest{
+		RunID:   archive.RunID(now, data),
+		Created: now.UTC(),
+		Output:  u.outputFile,
+		Policy:  policy.Name(),
+	}, u.txnsFile, u.profile.Roster, u.profile.Aliases, u.profile.Exclusions, u.profile.Goals, u.profile.Campaigns)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return bytes.NewReader(blob), nil
-}
-
-// getParents reads the parent-child data from an Excel spreadsheet
-func getParents() ([]*Parent, error) {
-	// Name of the master parents and kids file to be loaded from the
-	// storage bucket.  If this file doesn't exist then this program
-	// has nothing to do and will exist with a relevant message.
-	fileName := "parents-kids-classes.xlsx"
+	fmt.Printf("Inputs archived as run %s\n", manifest.RunID)
 
-	reader, err := getFileFromBucket(bucket, fileName)
-	if err != nil {
-		return nil, err
+	if err := u.store.Delete(ctx, u.txnsFile); err != nil {
+		fmt.Printf("Failed to delete transaction file %s: %v\n", u.txnsFile, err)
 	}
 
-	f, err := excelize.OpenReader(reader)
+	pruned, err := archive.Prune(ctx, u.store, now, retention)
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		fmt.Printf("Failed to prune archived runs: %v\n", err)
 	}
-
-	rows, err := f.GetRows("Data")
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
+	for _, runID := range pruned {
+		fmt.Printf("Archived run %s removed after the retention period\n", runID)
 	}
 
-	var parents []*Parent
-
-	for rowIndex, row := range rows {
-		// Skip the header row
-		if rowIndex == 0 {
-			continue
-		}
-
-		parentName := row[0]
-		accountNumber := row[7]
-
-		// All parents on this list have at least one child
-		firstChildName := row[1]
-		firstChildClass := row[2]
-
-		parent := &Parent{
-			Name: parentName,
-			Children: []Student{
-				{ // First child
-					Name:  firstChildName,
-					Class: firstChildClass,
-				},
-			},
-			AccountNumber: accountNumber,
-		}
-
-		// Check if parent has a second children
-		if row[3] != "" {
-			parent.Children = append(parent.Children, Student{
-				Name:  row[3],
-				Class: row[4],
-			})
-		}
-
-		// Check if parent has a third children, only likely if they have a second child
-		if row[5] != "" {
-			parent.Children = append(parent.Children, Student{
-				Name:  row[5],
-				Class: row[6],
-			})
-		}
+	return nil
+}
 
-		parents = append(parents, parent)
+// retentionFromEnv returns how long archived runs are kept, from the
+// number of days in ARCHIVE_RETENTION_DAYS.  Zero keeps them forever.
+func retentionFromEnv() (time.Duration, error) {
+	days := os.Getenv("ARCHIVE_RETENTION_DAYS")
+	if days == "" {
+		return 0, nil
+	}
 
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number of days %q", days)
 	}
 
-	return parents, nil
+	return time.Duration(n) * 24 * time.Hour, nil
 }
 
-func readTransactions() ([]*DonationTransation, error) {
-	reader, err := getFileFromBucket(bucket, txnsFile)
-	if err != nil {
-		return nil, err
+// historyFromEnv returns the first day of the donation history reports
+// cover, from HISTORY_FROM as YYYY-MM-DD, e.g. the start of the school
+// year.  Zero reports on the upload alone.
+func historyFromEnv() (time.Time, error) {
+	from := os.Getenv("HISTORY_FROM")
+	if from == "" {
+		return time.Time{}, nil
 	}
 
-	f, err := excelize.OpenReader(reader)
-	// f, err := excelize.OpenFile(os.Args[1])
+	t, err := time.Parse("2006-01-02", from)
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", from)
 	}
 
-	rows, err := f.GetRows("Data")
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
-	}
-
-	var donations []*DonationTransation
-
-	for rowIndex, row := range rows {
-		// Skip header and total rows
-		if rowIndex == 0 || rowIndex == 1 {
-			continue
-		}
-
-		txn := &DonationTransation{
-			Date:               row[0],
-			Name:               row[1],
-			Amount:             strings.ReplaceAll(row[2], " ", ""),
-			FirstStudentName:   row[6],
-			FirstStudentClass:  row[7],
-			SecondStudentName:  row[8],
-			SecondStudentClass: row[9],
-			ThirdStudentName:   row[10],
-			ThirdStudentClass:  row[11],
-			AccountNumber:      row[12],
-		}
-
-		donations = append(donations, txn)
+	return t, nil
+}
 
-	}
+// failure describes a failed run in the failure marker.
+type failure struct {
+	File      string    `json:"file"`
+	EventID   string    `json:"event_id,omitempty"`
+	Time      time.Time `json:"time"`
+	Stage     string    `json:"stage,omitempty"`
+	Error     string    `json:"error"`
+	Retryable bool      `json:"retryable"`
+}
 
-	return donations, nil
+// failureMarker returns the name of the failure marker of an upload.
+func failureMarker(txnsFile string) string {
+	return txnsFile + ".error.json"
 }
 
-func readTransactionsByNonCareGivers() ([]*DonationTransation, error) {
-	reader, err := getFileFromBucket(bucket, txnsFile)
-	if err != nil {
-		return nil, err
+// writeFailureMarker writes why the run failed next to the upload.
+func (u *upload) writeFailureMarker(ctx context.Context, e event.Event, err error) error {
+	marker := failure{
+		File:      u.txnsFile,
+		EventID:   e.ID(),
+		Time:      time.Now().UTC(),
+		Error:     err.Error(),
+		Retryable: report.IsRetryable(err),
 	}
 
-	f, err := excelize.OpenReader(reader)
-	// f, err := excelize.OpenFile(os.Args[1])
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
+	var reportErr *report.Error
+	if errors.As(err, &reportErr) {
+		marker.Stage = reportErr.Stage
 	}
 
-	rows, err := f.GetRows("Data")
+	data, err := json.MarshalIndent(marker, "", "  ")
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		return err
 	}
 
-	var donations []*DonationTransation
-
-	for rowIndex, row := range rows {
-		// Skip header and total rows
-		if rowIndex == 0 || rowIndex == 1 {
-			continue
-		}
-
-		// Ignore transactions with students associated with them
-		if row[6] != "" {
-			continue
-		}
-		if row[8] != "" {
-			continue
-		}
-		if row[10] != "" {
-			continue
-		}
-
-		txn := &DonationTransation{
-			Date:          row[0],
-			Name:          row[1],
-			Amount:        strings.ReplaceAll(row[2], " ", ""),
-			AccountNumber: row[12],
-		}
+	return u.store.Write(ctx, failureMarker(u.txnsFile), data)
+}
 
-		donations = append(donations, txn)
+// logError logs err with the error severity so that it can be alerted on.
+func logError(err error) {
+	logEntry("ERROR", err)
+}
 
-	}
+// logWarning logs err with the warning severity, for problems that
+// didn't stop the report.
+func logWarning(err error) {
+	logEntry("WARNING", err)
+}
 
-	return donations, nil
+func logEntry(severity string, err error) {
+	entry, _ := json.Marshal(map[string]string{
+		"severity": severity,
+		"message":  err.Error(),
+	})
+	fmt.Println(string(entry))
 }
@@ -3,48 +3,363 @@
 package donationsbystudent
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/jotacamou/datacor/internal/archive"
+	"github.com/jotacamou/datacor/internal/blob"
+	"github.com/jotacamou/datacor/internal/config"
+	"github.com/jotacamou/datacor/internal/history"
+	"github.com/jotacamou/datacor/internal/runs"
+	"github.com/jotacamou/datacor/internal/xlsxtest"
+	excelize "github.com/xuri/excelize/v2"
 )
 
-func TestAddParent(t *testing.T) {
-	tests := []struct {
-		name       string
-		student    Student
-		parentName string
-		expected   Student
-	}{
-		{
-			name:       "Add first parent",
-			student:    Student{},
-			parentName: "Parent1",
-			expected:   Student{Parent1: "Parent1"},
-		},
-		{
-			name:       "Add second parent",
-			student:    Student{Parent1: "Parent1"},
-			parentName: "Parent2",
-			expected:   Student{Parent1: "Parent1", Parent2: "Parent2"},
-		},
-		{
-			name:       "Add third parent",
-			student:    Student{Parent1: "Parent1", Parent2: "Parent2"},
-			parentName: "Parent3",
-			expected:   Student{Parent1: "Parent1", Parent2: "Parent2", Parent3: "Parent3"},
-		},
-		{
-			name:       "No space for new parent",
-			student:    Student{Parent1: "Parent1", Parent2: "Parent2", Parent3: "Parent3"},
-			parentName: "Parent4",
-			expected:   Student{Parent1: "Parent1", Parent2: "Parent2", Parent3: "Parent3"},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			addParent(&tt.student, tt.parentName)
-			if tt.student != tt.expected {
-				t.Errorf("got %v, want %v", tt.student, tt.expected)
-			}
-		})
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	u := newUpload(t, blob.NewMemory())
+
+	roster := xlsxtest.Workbook(t, [][]interface{}{
+		{"Parent Name", "Child 1 Name", "Child 1 Class"},
+		{"Jane Doe", "Sam Doe", "K"},
+	})
+	txns := xlsxtest.Workbook(t, [][]interface{}{
+		{"Date", "Donor Name", "Amount", "Student Name"},
+		{"", "Total", "$25.00"},
+		{"12/01/2024", "Jane Doe", "$25.00", "Sam Doe"},
+	})
+	if err := u.store.Write(ctx, "parents-kids-classes.xlsx", roster); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.store.Write(ctx, u.txnsFile, txns); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u.run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := u.store.Read(ctx, u.outputFile)
+	if err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+	if _, err := u.store.Read(ctx, u.txnsFile); !errors.Is(err, blob.ErrNotExist) {
+		t.Errorf("transactions file not cleaned up: %v", err)
+	}
+
+	archived, _ := u.store.List(ctx, archive.Prefix)
+	if len(archived) != 3 || !strings.HasSuffix(archived[0], "/"+u.txnsFile) || !strings.HasSuffix(archived[1], "/"+archive.ManifestFile) {
+		t.Errorf("unexpected archive: %v", archived)
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Donations By Student")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[2][0] != "Sam Doe" || rows[2][2] != "Jane Doe" {
+		t.Errorf("unexpected report rows: %v", rows)
+	}
+}
+
+// defaultProfile returns the profile of a deployment without any
+// configuration.
+func defaultProfile(t *testing.T) *config.Profile {
+	t.Helper()
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Profiles[0]
+}
+
+// newUpload returns the state of a run for an upload to s.
+func newUpload(t *testing.T, s blob.Store) *upload {
+	t.Helper()
+
+	return &upload{
+		store:      s,
+		txnsFile:   "2024-12-12-Report.xlsx",
+		outputFile: "donations_by_student-2024-12-12.xlsx",
+		profile:    defaultProfile(t),
+		runKey:     "g1",
+	}
+}
+
+// setUp writes a roster and an upload to s and returns the state of the
+// run for the upload.
+func setUp(t *testing.T, s blob.Store) *upload {
+	t.Helper()
+
+	u := newUpload(t, s)
+
+	files := map[string][]byte{
+		"parents-kids-classes.xlsx": xlsxtest.Workbook(t, [][]interface{}{
+			{"Parent Name", "Child 1 Name", "Child 1 Class"},
+			{"Jane Doe", "Sam Doe", "K"},
+		}),
+		u.txnsFile: xlsxtest.Workbook(t, [][]interface{}{
+			{"Date", "Donor Name", "Amount", "Student Name"},
+			{"", "Total", "$25.00"},
+			{"12/01/2024", "Jane Doe", "$25.00", "Sam Doe"},
+		}),
+	}
+	for name, data := range files {
+		if err := u.store.Write(context.Background(), name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return u
+}
+
+func TestProcessSkipsRepeatedEvents(t *testing.T) {
+	ctx := context.Background()
+	u := setUp(t, blob.NewMemory())
+
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := u.store.Delete(ctx, u.outputFile); err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+
+	// The same event again, after the upload was archived
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Errorf("repeated event failed: %v", err)
+	}
+	if _, err := u.store.Read(ctx, u.outputFile); !errors.Is(err, blob.ErrNotExist) {
+		t.Errorf("report written again for a processed upload: %v", err)
+	}
+	if _, err := u.store.Read(ctx, failureMarker(u.txnsFile)); !errors.Is(err, blob.ErrNotExist) {
+		t.Errorf("failure marker written for a repeated event: %v", err)
+	}
+}
+
+func TestProcessWaitsForLock(t *testing.T) {
+	ctx := context.Background()
+	u := setUp(t, blob.NewMemory())
+
+	// Another upload for the same date is being processed
+	lock, err := runs.Acquire(ctx, u.store, u.outputFile, "2024-12-12-Report.xlsx g0", time.Now(), lockTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = u.process(ctx, event.New())
+	if !errors.Is(err, runs.ErrLocked) {
+		t.Errorf("got %v, want ErrLocked returned for a retry", err)
+	}
+	if _, err := u.store.Read(ctx, u.outputFile); !errors.Is(err, blob.ErrNotExist) {
+		t.Errorf("report written while locked: %v", err)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Errorf("unexpected error after the lock was released: %v", err)
+	}
+}
+
+// finishingStore records the upload as processed just as the report lock
+// is taken, as if another delivery of the event finished first.
+type finishingStore struct {
+	*blob.Memory
+	entry runs.Entry
+}
+
+func (s finishingStore) Create(ctx context.Context, name string, data []byte) error {
+	if name == runs.LockPrefix+s.entry.Output+".lock" {
+		if err := runs.NewLedger(s.Memory).Record(ctx, s.entry); err != nil {
+			return err
+		}
+	}
+	return s.Memory.Create(ctx, name, data)
+}
+
+func TestProcessSkipsEventFinishedWhileLocking(t *testing.T) {
+	ctx := context.Background()
+	s := finishingStore{Memory: blob.NewMemory()}
+	u := setUp(t, &s)
+	s.entry = runs.Entry{Upload: u.txnsFile, Key: u.runKey, Output: u.outputFile}
+
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := u.store.Read(ctx, u.outputFile); !errors.Is(err, blob.ErrNotExist) {
+		t.Errorf("report written again for a processed upload: %v", err)
+	}
+	if _, err := u.store.Read(ctx, u.txnsFile); err != nil {
+		t.Errorf("upload archived again: %v", err)
+	}
+}
+
+func TestProcessListsChangesSinceLastReport(t *testing.T) {
+	ctx := context.Background()
+	u := setUp(t, blob.NewMemory())
+
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A week later the export has one more gift
+	u.txnsFile = "2024-12-19-Report.xlsx"
+	u.outputFile = "donations_by_student-2024-12-19.xlsx"
+	u.runKey = "g2"
+	txns := xlsxtest.Workbook(t, [][]interface{}{
+		{"Date", "Donor Name", "Amount", "Student Name"},
+		{"", "Total", "$35.00"},
+		{"12/01/2024", "Jane Doe", "$25.00", "Sam Doe"},
+		{"12/15/2024", "Uncle Bob", "$10.00", "Sam Doe"},
+	})
+	if err := u.store.Write(ctx, u.txnsFile, txns); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := u.store.Read(ctx, u.outputFile)
+	if err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Changes Since Last Report")
+	if err != nil {
+		t.Fatalf("changes not listed: %v", err)
+	}
+	if len(rows) != 5 || rows[0][1] != "12/12/2024" || rows[2][0] != "New Donation" || rows[3][0] != "New Donor" || rows[4][0] != "Total Changed" || rows[4][2] != "Sam Doe" {
+		t.Errorf("unexpected changes: %v", rows)
+	}
+}
+
+func TestProcessReportsOnHistory(t *testing.T) {
+	ctx := context.Background()
+	u := setUp(t, blob.NewMemory())
+	t.Setenv("HISTORY_FROM", "2024-08-01")
+
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The next export no longer has the December 1st gift
+	u.txnsFile = "2025-01-10-Report.xlsx"
+	u.outputFile = "donations_by_student-2025-01-10.xlsx"
+	u.runKey = "g2"
+	txns := xlsxtest.Workbook(t, [][]interface{}{
+		{"Date", "Donor Name", "Amount", "Student Name"},
+		{"", "Total", "$10.00"},
+		{"01/05/2025", "Uncle Bob", "$10.00", "Sam Doe"},
+		{"01/20/2025", "Aunt May", "$15.00", "Sam Doe"},
+	})
+	if err := u.store.Write(ctx, u.txnsFile, txns); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records, err := history.Load(ctx, u.store)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("got %d records, %v, want 3", len(records), err)
+	}
+
+	data, err := u.store.Read(ctx, u.outputFile)
+	if err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The gift dated after the upload isn't counted yet
+	rows, err := f.GetRows("Donations By Student")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[2][len(rows[2])-3] != "$35.00" {
+		t.Errorf("unexpected report rows: %v", rows)
+	}
+}
+
+// archiveFailingStore fails to write to the archive.
+type archiveFailingStore struct {
+	*blob.Memory
+}
+
+func (s archiveFailingStore) Write(ctx context.Context, name string, data []byte) error {
+	if strings.HasPrefix(name, archive.Prefix) {
+		return errors.New("archive unavailable")
+	}
+	return s.Memory.Write(ctx, name, data)
+}
+
+func TestProcessArchiveFailure(t *testing.T) {
+	ctx := context.Background()
+	u := setUp(t, archiveFailingStore{blob.NewMemory()})
+
+	// The report was written, so the run must not be retried
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Errorf("archive failure returned for a retry: %v", err)
+	}
+
+	if _, err := u.store.Read(ctx, u.outputFile); err != nil {
+		t.Errorf("report not written: %v", err)
+	}
+	if _, err := u.store.Read(ctx, failureMarker(u.txnsFile)); !errors.Is(err, blob.ErrNotExist) {
+		t.Errorf("failure marker written for a written report: %v", err)
+	}
+	if _, err := u.store.Read(ctx, u.txnsFile); err != nil {
+		t.Errorf("upload removed without being archived: %v", err)
+	}
+}
+
+func TestProcessWritesFailureMarker(t *testing.T) {
+	ctx := context.Background()
+	u := newUpload(t, blob.NewMemory())
+
+	// The roster is missing, which retrying won't fix
+	txns := xlsxtest.Workbook(t, [][]interface{}{
+		{"Date", "Donor Name", "Amount", "Student Name"},
+		{"", "Total", "$25.00"},
+		{"12/01/2024", "Jane Doe", "$25.00", "Sam Doe"},
+	})
+	if err := u.store.Write(ctx, u.txnsFile, txns); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u.process(ctx, event.New()); err != nil {
+		t.Errorf("permanent failure returned for a retry: %v", err)
+	}
+
+	data, err := u.store.Read(ctx, failureMarker(u.txnsFile))
+	if err != nil {
+		t.Fatalf("failure marker not written: %v", err)
+	}
+	if !strings.Contains(string(data), `"stage": "read roster"`) || !strings.Contains(string(data), `"retryable": false`) {
+		t.Errorf("unexpected failure marker: %s", data)
+	}
+	if _, err := u.store.Read(ctx, u.txnsFile); err != nil {
+		t.Errorf("upload removed after a failure: %v", err)
 	}
 }